@@ -0,0 +1,201 @@
+package http
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrLimitExceeded is returned by the adaptive limiters when a request is
+// shed because the current limit is reached.
+var ErrLimitExceeded = &LimitError{http.StatusServiceUnavailable, "concurrency limit exceeded"}
+
+// adaptive admits requests while fewer than limit are in flight. The
+// algorithms move limit between min and max as requests are released.
+type adaptive struct {
+	mu       sync.Mutex
+	limit    float64
+	min, max float64
+	inFlight int
+}
+
+func (a *adaptive) init(initial, min, max int) {
+	if min <= 0 {
+		min = 1
+	}
+	if max <= 0 {
+		max = 1000
+	}
+	if initial <= 0 {
+		initial = 20
+	}
+	a.min, a.max = float64(min), float64(max)
+	a.setLimit(float64(initial))
+}
+
+func (a *adaptive) Acquire(context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.inFlight >= int(a.limit) {
+		return ErrLimitExceeded
+	}
+	a.inFlight++
+
+	return nil
+}
+
+func (a *adaptive) Stats() LimitStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return LimitStats{InFlight: int64(a.inFlight), MaxInFlight: int(a.limit)}
+}
+
+// release must be called with mu held, it returns how many requests were in
+// flight including the released one.
+func (a *adaptive) release() int {
+	n := a.inFlight
+	a.inFlight--
+
+	return n
+}
+
+func (a *adaptive) setLimit(l float64) {
+	a.limit = math.Max(a.min, math.Min(a.max, l))
+}
+
+type AIMDConfig struct {
+	InitialLimit int // default 20
+	MinLimit     int // default 1
+	MaxLimit     int // default 1000
+
+	// BackoffRatio multiplies the limit on overload, default 0.9.
+	BackoffRatio float64
+
+	// Threshold is the latency above which a request counts as overload,
+	// 0 means only failed requests do.
+	Threshold time.Duration
+}
+
+// NewAIMDLimiter returns a Limiter that grows the limit by about one per
+// round trip while the limit is in use, and shrinks it by BackoffRatio on
+// failures or slow requests. Requests already in flight when the limit
+// shrinks do not shrink it again.
+func NewAIMDLimiter(c AIMDConfig) Limiter {
+	if c.BackoffRatio <= 0 || c.BackoffRatio >= 1 {
+		c.BackoffRatio = 0.9
+	}
+
+	l := &aimd{conf: c}
+	l.init(c.InitialLimit, c.MinLimit, c.MaxLimit)
+
+	return l
+}
+
+type aimd struct {
+	adaptive
+	conf AIMDConfig
+	skip int
+}
+
+func (l *aimd) Release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.release()
+
+	overload := failed || l.conf.Threshold > 0 && latency > l.conf.Threshold
+	switch {
+	case l.skip > 0:
+		l.skip--
+	case overload:
+		l.setLimit(l.limit * l.conf.BackoffRatio)
+		l.skip = n - 1
+	case float64(n)*2 >= l.limit:
+		l.setLimit(l.limit + 1/l.limit)
+	}
+}
+
+type GradientConfig struct {
+	InitialLimit int // default 20
+	MinLimit     int // default 1
+	MaxLimit     int // default 1000
+
+	// Smoothing weighs a new limit against the current one, default 0.2.
+	Smoothing float64
+
+	// Tolerance is how much slower than the no-load latency requests may
+	// get before the limit shrinks, default 1.5.
+	Tolerance float64
+
+	// Window is the number of samples after which the no-load latency is
+	// measured again, so that it follows lasting changes. Default 600.
+	Window int
+}
+
+// NewGradientLimiter returns a Limiter in the style of TCP Vegas and
+// Netflix's gradient limiters. It estimates the no-load latency as the
+// lowest latency of the recent samples: while requests are about that fast
+// the limit grows by its square root, once they slow down the limit shrinks
+// in proportion. Failed requests shrink it by 10%.
+func NewGradientLimiter(c GradientConfig) Limiter {
+	if c.Smoothing <= 0 || c.Smoothing > 1 {
+		c.Smoothing = 0.2
+	}
+	if c.Tolerance < 1 {
+		c.Tolerance = 1.5
+	}
+	if c.Window <= 0 {
+		c.Window = 600
+	}
+
+	l := &gradient{conf: c}
+	l.init(c.InitialLimit, c.MinLimit, c.MaxLimit)
+
+	return l
+}
+
+type gradient struct {
+	adaptive
+	conf GradientConfig
+
+	// the no-load latency is the lower of the minimum of the previous and
+	// the current window.
+	prevMin, curMin time.Duration
+	samples         int
+}
+
+func (l *gradient) Release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.release()
+
+	if failed {
+		l.setLimit(l.limit * 0.9)
+		return
+	}
+	if latency <= 0 {
+		return
+	}
+
+	if l.curMin == 0 || latency < l.curMin {
+		l.curMin = latency
+	}
+	if l.samples++; l.samples >= l.conf.Window {
+		l.prevMin, l.curMin, l.samples = l.curMin, 0, 0
+	}
+	base := l.curMin
+	if l.prevMin > 0 && (base == 0 || l.prevMin < base) {
+		base = l.prevMin
+	}
+
+	// An idle limit says nothing about the capacity.
+	if float64(n)*2 < l.limit {
+		return
+	}
+
+	g := math.Max(0.5, math.Min(1, l.conf.Tolerance*float64(base)/float64(latency)))
+	next := l.limit*g + math.Sqrt(l.limit)
+	l.setLimit(l.limit*(1-l.conf.Smoothing) + next*l.conf.Smoothing)
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var _default_go_limit = 64
+
+// ErrEngineClosed is returned by Go once Shutdown has started.
+var ErrEngineClosed = errors.New("engine is shutting down")
+
+type background struct {
+	once   sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	closing bool
+	sem     chan struct{}
+	wg      sync.WaitGroup
+}
+
+func (b *background) init() {
+	b.once.Do(func() {
+		b.ctx, b.cancel = context.WithCancel(context.Background())
+	})
+}
+
+// SetGoLimit sets how many tasks started by Go may run at the same time.
+// Tasks over the limit wait for a free slot.
+func (e *Engine) SetGoLimit(n int) error {
+	if n <= 0 {
+		return errors.New("Go limit must be greater than 0.")
+	}
+
+	e.bg.mu.Lock()
+	defer e.bg.mu.Unlock()
+	e.bg.sem = make(chan struct{}, n)
+
+	return nil
+}
+
+// Go runs fn in a new goroutine that Shutdown waits for. fn receives a
+// context that is cancelled when Shutdown gives up waiting. A panic in fn is
+// recovered and logged.
+func (e *Engine) Go(fn func(context.Context)) error {
+	logger := e.log()
+	b := &e.bg
+	b.init()
+
+	b.mu.Lock()
+	if b.closing {
+		b.mu.Unlock()
+		return ErrEngineClosed
+	}
+	if b.sem == nil {
+		b.sem = make(chan struct{}, _default_go_limit)
+	}
+	sem := b.sem
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	go func() {
+		defer b.wg.Done()
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+		case <-b.ctx.Done():
+			return
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Printf("background task panic: %v\n%s", r, debug.Stack())
+			}
+		}()
+		fn(b.ctx)
+	}()
+
+	return nil
+}
+
+// Go runs fn with a copy of ctx through Engine.Go. The copy is cancelled
+// when the task returns or the engine stops waiting for it.
+func (ctx *Context) Go(fn func(*Context)) error {
+	ctx.Engine.bg.init()
+	cp, cancel := ctx.copyWith(ctx.Engine.bg.ctx)
+	err := ctx.Engine.Go(func(context.Context) {
+		defer cancel()
+		fn(cp)
+	})
+	if err != nil {
+		cancel()
+	}
+
+	return err
+}
+
+// wait stops accepting tasks and waits for running ones until ctx is done,
+// then cancels whatever is left.
+func (b *background) wait(ctx context.Context) error {
+	b.init()
+	defer b.cancel()
+
+	b.mu.Lock()
+	b.closing = true
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "background tasks")
+	}
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func benchmarkEngine(b *testing.B, e *Engine, target string) {
+	r := httptest.NewRequest("GET", target, nil)
+	w := &discardWriter{header: make(http.Header)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkEngineStatic(b *testing.B) {
+	e := DefaultEngine()
+	e.GET("index", "/", func(ctx *Context) {})
+	benchmarkEngine(b, e, "/")
+}
+
+func BenchmarkEngineParam(b *testing.B) {
+	e := DefaultEngine()
+	e.GET("user", "/users/:id", func(ctx *Context) {
+		ctx.ParamInt("id")
+	})
+	benchmarkEngine(b, e, "/users/42")
+}
+
+func BenchmarkEngineRouteConfig(b *testing.B) {
+	e := DefaultEngine()
+	e.GET("index", "/", func(ctx *Context) {}, func(ctx *Context, next func(*Context)) {
+		next(ctx)
+	})
+	if err := e.SetRouteConfig("index", &Config{TimeOut: time.Second}); err != nil {
+		b.Fatal(err)
+	}
+	benchmarkEngine(b, e, "/")
+}
+
+func BenchmarkEngineParallel(b *testing.B) {
+	e := DefaultEngine()
+	e.GET("index", "/", func(ctx *Context) {})
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		r := httptest.NewRequest("GET", "/", nil)
+		w := &discardWriter{header: make(http.Header)}
+		for pb.Next() {
+			e.ServeHTTP(w, r)
+		}
+	})
+}
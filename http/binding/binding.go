@@ -3,26 +3,36 @@ package binding
 import (
 	"net/http"
 	"strings"
-
-	"github.com/go-playground/validator/v10"
 )
 
-var DefaultValidator = &Validator{
-	Validate: validator.New(),
-}
+// DefaultValidator validates the values bound by the Bind methods of the
+// bindings.
+var DefaultValidator StructValidator = NewValidator()
 
 var (
 	JSON          = &jsonBinding{}
+	XML           = &xmlBinding{}
+	YAML          = &yamlBinding{}
+	MergePatch    = &mergePatchBinding{}
+	JSONPatch     = &jsonPatchBinding{}
 	Query         = &queryBinding{}
 	Form          = &formBinding{}
 	FormMultipart = &formMultipartBinding{}
 	FormPost      = &formPostBinding{}
+	Header        = &headerBinding{}
+	Cookie        = &cookieBinding{}
+	Uri           = &uriBinding{}
 )
 
 const (
 	MIME_JSON              = "application/json"
+	MIME_MergePatch        = "application/merge-patch+json"
+	MIME_JSONPatch         = "application/json-patch+json"
 	MIME_HTML              = "text/html"
 	MIME_XML               = "application/xml"
+	MIME_XML2              = "text/xml"
+	MIME_YAML              = "application/yaml"
+	MIME_YAML2             = "application/x-yaml"
 	MIME_Plain             = "text/plain"
 	MIME_POSTForm          = "application/x-www-form-urlencoded"
 	MIME_MultipartPOSTForm = "multipart/form-data"
@@ -33,8 +43,17 @@ type BindingInterface interface {
 	Bind(*http.Request, interface{}) error
 }
 
-type Validator struct {
-	*validator.Validate
+// Decoder is implemented by bindings that can fill obj without validating
+// it, so that callers can validate with their own StructValidator.
+type Decoder interface {
+	Decode(*http.Request, interface{}) error
+}
+
+// ValidatingDecoder is implemented by bindings that decode into a copy of
+// obj and store it only when check accepts the copy, like the patch
+// bindings whose target holds the current value.
+type ValidatingDecoder interface {
+	DecodeValidate(req *http.Request, obj interface{}, check func(interface{}) error) error
 }
 
 func Default(method, contentType string) BindingInterface {
@@ -44,6 +63,14 @@ func Default(method, contentType string) BindingInterface {
 	switch cleanContentType(contentType) {
 	case MIME_JSON:
 		return JSON
+	case MIME_MergePatch:
+		return MergePatch
+	case MIME_JSONPatch:
+		return JSONPatch
+	case MIME_XML, MIME_XML2:
+		return XML
+	case MIME_YAML, MIME_YAML2:
+		return YAML
 	case MIME_POSTForm:
 		return FormPost
 	case MIME_MultipartPOSTForm:
@@ -53,11 +80,8 @@ func Default(method, contentType string) BindingInterface {
 	}
 }
 
-func validate(obj interface{}) error {
-	if DefaultValidator == nil {
-		return nil
-	}
-	return DefaultValidator.Struct(obj)
+func validate(req *http.Request, obj interface{}, opts ...BindOption) error {
+	return Validate(DefaultValidator, req, obj, opts...)
 }
 
 func cleanContentType(contentType string) string {
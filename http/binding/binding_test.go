@@ -2,10 +2,15 @@ package binding
 
 import (
 	"bytes"
+	"fmt"
 	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -39,6 +44,12 @@ func TestBindingDefault(t *testing.T) {
 	assert.Equal(t, Default("POST", "application/json; charset=utf-8"), JSON)
 	assert.Equal(t, Default("POST", "application/x-www-form-urlencoded; charset=utf-8"), FormPost)
 	assert.Equal(t, Default("POST", "multipart/form-data; charset=utf-8"), FormMultipart)
+	assert.Equal(t, Default("POST", "application/xml; charset=utf-8"), XML)
+	assert.Equal(t, Default("PUT", "text/xml"), XML)
+	assert.Equal(t, Default("PATCH", "application/merge-patch+json"), MergePatch)
+	assert.Equal(t, Default("PATCH", "application/json-patch+json; charset=utf-8"), JSONPatch)
+	assert.Equal(t, Default("POST", "application/yaml"), YAML)
+	assert.Equal(t, Default("POST", "application/x-yaml; charset=utf-8"), YAML)
 }
 
 func TestMapping(t *testing.T) {
@@ -79,6 +90,119 @@ func TestMapping(t *testing.T) {
 	assert.Equal(t, n.Bool, false)
 }
 
+type TestAddress struct {
+	City string `form:"city"`
+	Zip  string `form:"zip"`
+}
+
+type TestItem struct {
+	Name string `form:"name"`
+	Qty  int    `form:"qty" default:"1"`
+}
+
+type TestNestedStruct struct {
+	User struct {
+		Name    string       `form:"name"`
+		Address TestAddress  `form:"address"`
+		Billing *TestAddress `form:"billing"`
+	} `form:"user"`
+	Shipping *TestAddress           `form:"shipping"`
+	Items    []TestItem             `form:"items"`
+	Attrs    map[string]string      `form:"attrs"`
+	Tags     map[string][]string    `form:"tags"`
+	Places   map[string]TestAddress `form:"places"`
+	IDs      []int                  `form:"ids"`
+}
+
+func TestNestedMapping(t *testing.T) {
+	form := map[string][]string{
+		"user[name]":          {"liu"},
+		"user[address][city]": {"Paris"},
+		"user.address.zip":    {"75001"},
+		"items[3][name]":      {"pen"},
+		"items[0][name]":      {"book"},
+		"items[0][qty]":       {"2"},
+		"attrs[color]":        {"red"},
+		"attrs[size]":         {"xl"},
+		"tags[a]":             {"x", "y"},
+		"places[home][city]":  {"Lyon"},
+		"ids[]":               {"1", "2"},
+		"unrelated[foo][bar]": {"baz"},
+		"shipping.city":       {"Nice"},
+	}
+	m := new(TestNestedStruct)
+	assert.Nil(t, mapForm(m, form))
+	assert.Equal(t, m.User.Name, "liu")
+	assert.Equal(t, m.User.Address, TestAddress{City: "Paris", Zip: "75001"})
+	assert.Nil(t, m.User.Billing)
+	assert.Equal(t, m.Shipping, &TestAddress{City: "Nice"})
+	assert.Equal(t, m.Items, []TestItem{{Name: "book", Qty: 2}, {Name: "pen", Qty: 1}})
+	assert.Equal(t, m.Attrs, map[string]string{"color": "red", "size": "xl"})
+	assert.Equal(t, m.Tags, map[string][]string{"a": {"x", "y"}})
+	assert.Equal(t, m.Places, map[string]TestAddress{"home": {City: "Lyon"}})
+	assert.Equal(t, m.IDs, []int{1, 2})
+
+	assert.Error(t, mapForm(new(TestNestedStruct), map[string][]string{"items[x][name]": {"pen"}}))
+}
+
+type testLevel int
+
+func (l *testLevel) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.Errorf("unknown level %q", b)
+	}
+	return nil
+}
+
+type testDecimal struct {
+	units, cents int64
+}
+
+type TestCustomStruct struct {
+	Level    testLevel     `form:"level"`
+	Levels   []testLevel   `form:"levels"`
+	MaybeLvl *testLevel    `form:"maybe_level"`
+	Timeout  time.Duration `form:"timeout"`
+	Price    testDecimal   `form:"price"`
+	Discount *testDecimal  `form:"discount"`
+	Age      *int          `form:"age"`
+	Name     *string       `form:"name"`
+}
+
+func TestCustomMapping(t *testing.T) {
+	RegisterConverter(reflect.TypeOf(testDecimal{}), func(s string) (any, error) {
+		var d testDecimal
+		_, err := fmt.Sscanf(s, "%d.%d", &d.units, &d.cents)
+		return d, err
+	})
+
+	m := new(TestCustomStruct)
+	assert.Nil(t, mapForm(m, map[string][]string{
+		"level":    {"high"},
+		"levels":   {"low", "high"},
+		"timeout":  {"1m30s"},
+		"price":    {"12.50"},
+		"discount": {"1.05"},
+		"age":      {"30"},
+	}))
+	assert.Equal(t, m.Level, testLevel(2))
+	assert.Equal(t, m.Levels, []testLevel{1, 2})
+	assert.Nil(t, m.MaybeLvl)
+	assert.Equal(t, m.Timeout, 90*time.Second)
+	assert.Equal(t, m.Price, testDecimal{12, 50})
+	assert.Equal(t, m.Discount, &testDecimal{1, 5})
+	assert.Equal(t, *m.Age, 30)
+	assert.Nil(t, m.Name)
+
+	assert.Error(t, mapForm(new(TestCustomStruct), map[string][]string{"level": {"medium"}}))
+	assert.Error(t, mapForm(new(TestCustomStruct), map[string][]string{"price": {"x"}}))
+}
+
 func TestCleanContentType(t *testing.T) {
 	c1 := "application/json"
 	c2 := "application/json; charset=utf-8"
@@ -110,6 +234,35 @@ func TestJSONBinding(t *testing.T) {
 	assert.Equal(t, foo.Bar, "world")
 }
 
+func TestXMLBinding(t *testing.T) {
+	request := requestWithBody("POST", "/", MIME_XML, `<?xml version="1.0"?><Foo><Foo>hello</Foo><Bar>world</Bar></Foo>`)
+	foo := new(Foo)
+	assert.Equal(t, XML.Bind(request, foo), nil)
+	assert.Equal(t, foo.Foo, "hello")
+	assert.Equal(t, foo.Bar, "world")
+
+	request = requestWithBody("POST", "/", MIME_XML, `<Foo><Foo>hello</Foo></Foo>`)
+	assert.Error(t, XML.Bind(request, new(Foo)))
+
+	request = requestWithBody("POST", "/", MIME_XML2, `<!DOCTYPE Foo [<!ENTITY x "hello">]><Foo><Foo>&x;</Foo><Bar>world</Bar></Foo>`)
+	assert.ErrorIs(t, XML.Bind(request, new(Foo)), ErrXMLDirective)
+
+	request = requestWithBody("POST", "/", MIME_XML, `<Foo><Foo>hello</Foo><Bar>world</Bar></Foo>`)
+	LimitBody(request, 10)
+	assert.Equal(t, XML.Bind(request, new(Foo)), &BodyTooLargeError{Limit: 10})
+}
+
+func TestYAMLBinding(t *testing.T) {
+	request := requestWithBody("POST", "/", MIME_YAML, "foo: hello\nbar: world\n")
+	foo := new(Foo)
+	assert.Equal(t, YAML.Bind(request, foo), nil)
+	assert.Equal(t, foo.Foo, "hello")
+	assert.Equal(t, foo.Bar, "world")
+
+	request = requestWithBody("POST", "/", MIME_YAML, "foo: [hello\n")
+	assert.Error(t, YAML.Bind(request, new(Foo)))
+}
+
 func TestValidationFails(t *testing.T) {
 	var obj Foo
 	req := requestWithBody("POST", "/", MIME_JSON, `{"bar": "foo"}`)
@@ -117,6 +270,107 @@ func TestValidationFails(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestValidationErrors(t *testing.T) {
+	type address struct {
+		City string `json:"city" validate:"required"`
+	}
+	type user struct {
+		Name    string  `form:"name" validate:"required"`
+		Age     int     `json:"age" form:"years" validate:"gte=18"`
+		Address address `json:"address"`
+	}
+
+	req := requestWithBody("POST", "/", MIME_JSON, `{"age": 3}`)
+	err := JSON.Bind(req, new(user))
+	assert.Equal(t, err, Errors{
+		"name":         "name is a required field",
+		"age":          "age must be 18 or greater",
+		"address.city": "city is a required field",
+	})
+	assert.Equal(t, err.(Errors).StatusCode(), http.StatusUnprocessableEntity)
+	assert.Equal(t, err.Error(), "address.city: city is a required field; age: age must be 18 or greater; name: name is a required field")
+
+	req = requestWithBody("POST", "/", MIME_JSON, `{"age": 20, "address": {"city": "x"}}`)
+	req.Header.Set("Accept-Language", "fr;q=0.9, zh-CN, en;q=0.8")
+	assert.Equal(t, JSON.Bind(req, new(user)), Errors{"name": "name为必填字段"})
+}
+
+func TestErrorsRender(t *testing.T) {
+	w := httptest.NewRecorder()
+	e := Errors{"name": "name is a required field"}
+	e.WriteContentType(w)
+	w.WriteHeader(e.StatusCode())
+	assert.Nil(t, e.Render(w))
+	assert.Equal(t, w.Code, http.StatusUnprocessableEntity)
+	assert.Equal(t, w.Result().Header.Get("Content-Type"), "application/json; charset=utf-8")
+	assert.Equal(t, w.Body.String(), `{"errors":{"name":"name is a required field"}}`+"\n")
+}
+
+func TestAcceptLanguages(t *testing.T) {
+	assert.Equal(t, AcceptLanguages(""), []string(nil))
+	assert.Equal(t, AcceptLanguages("en-US,zh;q=0.9,*;q=0.1"), []string{"en_us", "en", "zh"})
+	assert.Equal(t, AcceptLanguages("en;q=0.5, zh-Hans-CN"), []string{"zh_hans_cn", "zh", "en"})
+}
+
+func TestLimitBody(t *testing.T) {
+	req := requestWithBody("POST", "/", MIME_JSON, `{"foo":"hello","bar":"world"}`)
+	LimitBody(req, 10)
+	err := JSON.Bind(req, new(Foo))
+	assert.Equal(t, err, &BodyTooLargeError{Limit: 10})
+
+	req = requestWithBody("POST", "/", MIME_POSTForm, "foo=hello&bar=world")
+	LimitBody(req, 19)
+	assert.Nil(t, FormPost.Bind(req, new(Foo)))
+	req = requestWithBody("POST", "/", MIME_POSTForm, "foo=hello&bar=world")
+	LimitBody(req, 18)
+	assert.Equal(t, FormPost.Bind(req, new(Foo)), &BodyTooLargeError{Limit: 18})
+
+	req = requestWithBody("POST", "/", MIME_YAML, "foo: hello\nbar: world\n")
+	LimitBody(req, 10)
+	assert.Equal(t, YAML.Bind(req, new(Foo)), &BodyTooLargeError{Limit: 10})
+	req = requestWithBody("POST", "/", MIME_YAML, "foo: hello\n")
+	LimitBody(req, 11)
+	assert.Nil(t, YAML.Decode(req, new(Foo)))
+}
+
+func TestQueryBinding(t *testing.T) {
+	request := requestWithBody("GET", "/?foo=hello&bar=world", "", "")
+	foo := new(Foo)
+	assert.Equal(t, Query.Bind(request, foo), nil)
+	assert.Equal(t, foo.Foo, "hello")
+	assert.Equal(t, foo.Bar, "world")
+	assert.Error(t, Query.Bind(requestWithBody("GET", "/?foo=hello", "", ""), new(Foo)))
+}
+
+type TestSourceStruct struct {
+	ID      int    `uri:"id"`
+	Token   string `header:"x-token"`
+	Session string `cookie:"session"`
+	Lang    string `header:"Accept-Language" default:"en"`
+	Skipped string
+}
+
+type testParams map[string]string
+
+func (ps testParams) ByName(name string) string {
+	return ps[name]
+}
+
+func TestSourceBinding(t *testing.T) {
+	req := requestWithBody("GET", "/", "", "")
+	req.Header.Set("X-Token", "secret")
+	req.Header.Set("Skipped", "nope")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+	obj := new(TestSourceStruct)
+	assert.Nil(t, Header.Bind(req, obj))
+	assert.Nil(t, Cookie.Bind(req, obj))
+	assert.Nil(t, Uri.BindUri(testParams{"id": "7"}, obj))
+	assert.Equal(t, obj, &TestSourceStruct{ID: 7, Token: "secret", Session: "abc", Lang: "en"})
+
+	assert.Error(t, Uri.BindUri(testParams{"id": "x"}, obj))
+}
+
 func BenchmarkBindingForm(b *testing.B) {
 	req := requestWithBody("POST", "/", MIME_POSTForm, "foo=bar&bar=foo")
 	req.Header.Add("Content-Type", MIME_POSTForm)
@@ -0,0 +1,98 @@
+package binding
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// BodyTooLargeError is returned when a request body exceeds the limit set
+// by LimitBody. It maps to a 413 Request Entity Too Large.
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body too large, the limit is %d bytes", e.Limit)
+}
+
+func (e *BodyTooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// LimitBody makes reads of req.Body fail with *BodyTooLargeError once more
+// than n bytes are read.
+func LimitBody(req *http.Request, n int64) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	req.Body = &limitedBody{ReadCloser: req.Body, n: n, err: &BodyTooLargeError{Limit: n}}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	n   int64
+	err error
+}
+
+func (l *limitedBody) Read(p []byte) (n int, err error) {
+	if l.n < 0 {
+		return 0, l.err
+	}
+	// read one byte more than allowed to tell a body of exactly n bytes
+	// from a longer one.
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err = l.ReadCloser.Read(p)
+	if int64(n) <= l.n {
+		l.n -= int64(n)
+		return n, err
+	}
+	n = int(l.n)
+	l.n = -1
+
+	return n, l.err
+}
+
+// overflowError returns the *BodyTooLargeError of body once it has read
+// past its limit and err otherwise, for decoders like yaml.v3 that turn
+// read errors into strings.
+func overflowError(body io.Reader, err error) error {
+	if l, ok := body.(*limitedBody); ok && l.n < 0 {
+		return l.err
+	}
+
+	return err
+}
+
+// DecodeError reports a request body or value that cannot be decoded into
+// the bound value. It maps to a 400 Bad Request.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecodeError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// bodyError keeps a *BodyTooLargeError as is so callers can map it to 413,
+// other errors become a *DecodeError.
+func bodyError(err error) error {
+	var tooLarge *BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		return tooLarge
+	}
+
+	return &DecodeError{errors.WithStack(err)}
+}
@@ -0,0 +1,82 @@
+package binding
+
+import (
+	"encoding"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Converter turns a form value into a value of the type it is registered
+// for.
+type Converter func(string) (any, error)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	converters = struct {
+		sync.RWMutex
+		m map[reflect.Type]Converter
+	}{m: map[reflect.Type]Converter{
+		reflect.TypeOf(time.Duration(0)): func(s string) (any, error) {
+			if s == "" {
+				return time.Duration(0), nil
+			}
+			return time.ParseDuration(s)
+		},
+	}}
+)
+
+// RegisterConverter makes form binding fill fields of type t with fn,
+// for types that do not implement encoding.TextUnmarshaler. It takes
+// precedence over the built-in conversions.
+func RegisterConverter(t reflect.Type, fn Converter) {
+	converters.Lock()
+	converters.m[t] = fn
+	converters.Unlock()
+	scache.reset()
+}
+
+func converterOf(t reflect.Type) Converter {
+	converters.RLock()
+	defer converters.RUnlock()
+	return converters.m[t]
+}
+
+// isCustom reports whether values of t are set by a converter or by
+// UnmarshalText rather than by kind.
+func isCustom(t reflect.Type) bool {
+	return converterOf(t) != nil || reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// setCustom sets field from val with its converter or UnmarshalText, ok
+// is false when field has neither.
+func setCustom(val string, field reflect.Value) (ok bool, err error) {
+	t := field.Type()
+	if fn := converterOf(t); fn != nil {
+		v, err := fn(val)
+		if err != nil {
+			return true, errors.WithStack(err)
+		}
+		rv := reflect.ValueOf(v)
+		switch {
+		case !rv.IsValid():
+			field.Set(reflect.Zero(t))
+		case rv.Type().AssignableTo(t):
+			field.Set(rv)
+		case rv.Type().ConvertibleTo(t):
+			field.Set(rv.Convert(t))
+		default:
+			return true, errors.Errorf("converter for %s returned %s", t, rv.Type())
+		}
+		return true, nil
+	}
+	if field.CanAddr() {
+		if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return true, errors.WithStack(u.UnmarshalText([]byte(val)))
+		}
+	}
+	return false, nil
+}
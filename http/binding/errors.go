@@ -0,0 +1,81 @@
+package binding
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Errors maps the form or json name of each invalid field to a message in
+// the language of the request. Nested fields are named by their path, e.g.
+// user.address.city or items[0].name.
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + ": " + e[name]
+	}
+	return strings.Join(names, "; ")
+}
+
+func (e Errors) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// WriteContentType sets the JSON Content-Type unless one is set.
+func (e Errors) WriteContentType(w http.ResponseWriter) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+}
+
+// Render writes {"errors": {name: message}}, the status is written by the
+// caller.
+func (e Errors) Render(w http.ResponseWriter) error {
+	e.WriteContentType(w)
+	err := json.NewEncoder(w).Encode(map[string]map[string]string{"errors": e})
+	return errors.WithStack(err)
+}
+
+// AcceptLanguages returns the languages of an Accept-Language header by
+// preference, each region tag followed by its base language, e.g.
+// "zh-CN,en;q=0.8" gives zh_cn, zh, en.
+func AcceptLanguages(header string) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+	var ls []lang
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if f, err := strconv.ParseFloat(params[2:], 64); err == nil {
+				q = f
+			}
+		}
+		ls = append(ls, lang{strings.ToLower(strings.ReplaceAll(tag, "-", "_")), q})
+	}
+	sort.SliceStable(ls, func(i, j int) bool { return ls[i].q > ls[j].q })
+
+	var out []string
+	for _, l := range ls {
+		out = append(out, l.tag)
+		if base, _, ok := strings.Cut(l.tag, "_"); ok {
+			out = append(out, base)
+		}
+	}
+	return out
+}
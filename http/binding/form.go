@@ -1,10 +1,6 @@
 package binding
 
-import (
-	"net/http"
-
-	"github.com/pkg/errors"
-)
+import "net/http"
 
 const defaultMemory = 32 * 1024 * 1024
 
@@ -17,13 +13,17 @@ func (f formBinding) Name() string {
 }
 
 func (f formBinding) Bind(req *http.Request, obj interface{}) error {
-	if err := req.ParseForm(); err != nil {
-		return errors.WithStack(err)
-	}
-	if err := mapForm(obj, req.Form); err != nil {
+	if err := f.Decode(req, obj); err != nil {
 		return err
 	}
-	return validate(obj)
+	return validate(req, obj, FieldTag("form"))
+}
+
+func (formBinding) Decode(req *http.Request, obj interface{}) error {
+	if err := req.ParseForm(); err != nil {
+		return bodyError(err)
+	}
+	return mapForm(obj, req.Form)
 }
 
 func (f formPostBinding) Name() string {
@@ -31,13 +31,17 @@ func (f formPostBinding) Name() string {
 }
 
 func (f formPostBinding) Bind(req *http.Request, obj interface{}) error {
-	if err := req.ParseForm(); err != nil {
-		return errors.WithStack(err)
-	}
-	if err := mapForm(obj, req.PostForm); err != nil {
+	if err := f.Decode(req, obj); err != nil {
 		return err
 	}
-	return validate(obj)
+	return validate(req, obj, FieldTag("form"))
+}
+
+func (formPostBinding) Decode(req *http.Request, obj interface{}) error {
+	if err := req.ParseForm(); err != nil {
+		return bodyError(err)
+	}
+	return mapForm(obj, req.PostForm)
 }
 
 func (f formMultipartBinding) Name() string {
@@ -45,11 +49,15 @@ func (f formMultipartBinding) Name() string {
 }
 
 func (f formMultipartBinding) Bind(req *http.Request, obj interface{}) error {
-	if err := req.ParseMultipartForm(defaultMemory); err != nil {
-		return errors.WithStack(err)
-	}
-	if err := mapForm(obj, req.MultipartForm.Value); err != nil {
+	if err := f.Decode(req, obj); err != nil {
 		return err
 	}
-	return validate(obj)
+	return validate(req, obj, FieldTag("form"))
+}
+
+func (formMultipartBinding) Decode(req *http.Request, obj interface{}) error {
+	if err := req.ParseMultipartForm(defaultMemory); err != nil {
+		return bodyError(err)
+	}
+	return mapForm(obj, req.MultipartForm.Value)
 }
@@ -1,7 +1,11 @@
 package binding
 
 import (
+	"encoding/base64"
+	"net/http"
+	"net/textproto"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -10,93 +14,339 @@ import (
 	"github.com/pkg/errors"
 )
 
+var timeType = reflect.TypeOf(time.Time{})
+
 // scache struct reflect type cache.
 var scache = &cache{
-	data: make(map[reflect.Type]*sinfo),
+	data: make(map[ckey]*sinfo),
+}
+
+// ckey keys the cache by struct type and the tag its fields are named by.
+type ckey struct {
+	tp  reflect.Type
+	tag string
 }
 
 type cache struct {
-	data  map[reflect.Type]*sinfo
+	data  map[ckey]*sinfo
 	mutex sync.RWMutex
 }
 
-func (c *cache) get(obj reflect.Type) (s *sinfo) {
+func (c *cache) get(obj reflect.Type, tag string) (s *sinfo) {
 	var ok bool
 	c.mutex.RLock()
-	if s, ok = c.data[obj]; !ok {
+	if s, ok = c.data[ckey{obj, tag}]; !ok {
 		c.mutex.RUnlock()
-		s = c.set(obj)
+		s = c.set(obj, tag)
 		return
 	}
 	c.mutex.RUnlock()
 	return
 }
 
-func (c *cache) set(obj reflect.Type) (s *sinfo) {
-	s = new(sinfo)
-	tp := obj.Elem()
+// reset drops the cached fields, whose kinds depend on the registered
+// converters.
+func (c *cache) reset() {
+	c.mutex.Lock()
+	c.data = make(map[ckey]*sinfo)
+	c.mutex.Unlock()
+}
+
+func (c *cache) set(tp reflect.Type, tag string) (s *sinfo) {
+	s = &sinfo{names: make(map[string]bool)}
 	for i := 0; i < tp.NumField(); i++ {
 		fd := new(field)
 		fd.tp = tp.Field(i)
-		tag := fd.tp.Tag.Get("form")
-		fd.name, fd.option = parseTag(tag)
+		fd.name, fd.option = parseTag(fd.tp.Tag.Get(tag))
+		if fd.name != "" && tag == "header" {
+			fd.name = textproto.CanonicalMIMEHeaderKey(fd.name)
+		}
+		fd.kind = kindOf(fd.tp.Type)
 		if defV := fd.tp.Tag.Get("default"); defV != "" {
 			dv := reflect.New(fd.tp.Type).Elem()
-			setWithProperType(fd.tp.Type.Kind(), []string{defV}, dv, fd.option)
+			setWithProperType([]string{defV}, dv, fd.tp, fd.option)
 			fd.hasDefault = true
 			fd.defaultValue = dv
 		}
 		s.field = append(s.field, fd)
+
+		switch {
+		case fd.name == "-" || fd.option.Contains("remain"):
+		case fd.name != "":
+			s.names[fd.name] = true
+		case fd.kind == kindStruct:
+			for name := range c.get(fd.tp.Type, tag).names {
+				s.names[name] = true
+			}
+		default:
+			s.names[fd.tp.Name] = true
+		}
 	}
 	c.mutex.Lock()
-	c.data[obj] = s
+	c.data[ckey{tp, tag}] = s
 	c.mutex.Unlock()
 	return
 }
 
 type sinfo struct {
 	field []*field
+	names map[string]bool // input names taken by the fields, for remain
 }
 
 type field struct {
 	tp     reflect.StructField
 	name   string
 	option tagOptions
+	kind   fieldKind
 
 	hasDefault   bool          // if field had default value
 	defaultValue reflect.Value // field default value
 }
 
+// fieldKind tells how a field is filled from a form.
+type fieldKind int
+
+const (
+	kindValue       fieldKind = iota // one input, e.g. name=x or ids=1&ids=2
+	kindStruct                       // user[name]=x or user.name=x
+	kindPtrStruct                    // like kindStruct, allocated when present
+	kindSliceStruct                  // items[0][name]=x
+	kindMap                          // attrs[color]=red
+)
+
+func kindOf(t reflect.Type) fieldKind {
+	if isCustom(t) || t.Kind() == reflect.Ptr && isCustom(t.Elem()) {
+		return kindValue
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if t != timeType {
+			return kindStruct
+		}
+	case reflect.Ptr:
+		if t.Elem().Kind() == reflect.Struct && t.Elem() != timeType {
+			return kindPtrStruct
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Struct && t.Elem() != timeType && !isCustom(t.Elem()) {
+			return kindSliceStruct
+		}
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return kindMap
+		}
+	}
+	return kindValue
+}
+
+// source looks up the values of a named input.
+type source interface {
+	lookup(name string) ([]string, bool)
+}
+
+type formSource map[string][]string
+
+func (f formSource) lookup(name string) ([]string, bool) {
+	vs, ok := f[name]
+	return vs, ok
+}
+
+// suffixes returns the distinct first segments of the rest of the keys
+// that start with prefix, see segment.
+func (f formSource) suffixes(prefix string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for k := range f {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		s := segment(k[len(prefix):])
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+type headerSource http.Header
+
+func (h headerSource) lookup(name string) ([]string, bool) {
+	vs, ok := h[name]
+	return vs, ok
+}
+
+type cookieSource struct {
+	req *http.Request
+}
+
+func (c cookieSource) lookup(name string) ([]string, bool) {
+	ck, err := c.req.Cookie(name)
+	if err != nil {
+		return nil, false
+	}
+	return []string{ck.Value}, true
+}
+
+type paramSource struct {
+	ps Params
+}
+
+func (p paramSource) lookup(name string) ([]string, bool) {
+	v := p.ps.ByName(name)
+	if v == "" {
+		return nil, false
+	}
+	return []string{v}, true
+}
+
 func mapForm(ptr interface{}, form map[string][]string) error {
-	sinfo := scache.get(reflect.TypeOf(ptr))
-	val := reflect.ValueOf(ptr).Elem()
+	return mapping(ptr, formSource(normalizeForm(form)), "form")
+}
+
+// segment returns the first segment of a normalized key, up to the next
+// dot or, for a segment kept in brackets, up to its closing bracket.
+func segment(key string) string {
+	if strings.HasPrefix(key, "[") {
+		if i := strings.IndexByte(key, ']'); i >= 0 {
+			return key[:i+1]
+		}
+	}
+	if i := strings.IndexByte(key, '.'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// unbracket returns the name of a segment, without the brackets of one
+// holding a dot.
+func unbracket(seg string) string {
+	if strings.HasPrefix(seg, "[") && strings.HasSuffix(seg, "]") {
+		return seg[1 : len(seg)-1]
+	}
+	return seg
+}
+
+// normalizeForm rewrites bracket keys to dot keys, user[address][city]
+// becomes user.address.city and ids[] becomes ids. A bracket segment with
+// a dot keeps its brackets, attrs[color.dark] becomes attrs.[color.dark],
+// so that map keys may hold dots.
+func normalizeForm(form map[string][]string) map[string][]string {
+	brackets := false
+	for k := range form {
+		if strings.IndexByte(k, '[') >= 0 {
+			brackets = true
+			break
+		}
+	}
+	if !brackets {
+		return form
+	}
+
+	out := make(map[string][]string, len(form))
+	for k, vs := range form {
+		if i := strings.IndexByte(k, '['); i >= 0 && strings.HasSuffix(k, "]") {
+			segs := strings.Split(k[i+1:len(k)-1], "][")
+			for j, seg := range segs {
+				if strings.IndexByte(seg, '.') >= 0 {
+					segs[j] = "[" + seg + "]"
+				}
+			}
+			k = strings.TrimSuffix(k[:i]+"."+strings.Join(segs, "."), ".")
+		}
+		out[k] = append(out[k], vs...)
+	}
+	return out
+}
+
+// mapping fills the fields of ptr named by tag from src. Fields without
+// the tag are matched by their Go name for the "form" tag and skipped for
+// the others, untagged struct fields are mapped recursively. Form sources
+// also fill nested structs, slices of structs and maps, and a map field
+// tagged `form:",remain"` catches the keys no other field takes.
+// Values that cannot be converted fail with a *DecodeError.
+func mapping(ptr interface{}, src source, tag string) error {
+	if err := mapStruct(reflect.ValueOf(ptr).Elem(), src, tag, ""); err != nil {
+		return &DecodeError{err}
+	}
+	return nil
+}
+
+func mapStruct(val reflect.Value, src source, tag, prefix string) error {
+	form, nested := src.(formSource)
+	sinfo := scache.get(val.Type(), tag)
 	for i, fd := range sinfo.field {
 		typeField := fd.tp
 		structField := val.Field(i)
-		if !structField.CanSet() {
+		if !structField.CanSet() || fd.name == "-" {
+			continue
+		}
+
+		if fd.option.Contains("remain") && fd.kind == kindMap {
+			if nested {
+				if err := mapRemain(structField, form, sinfo, prefix, fd); err != nil {
+					return err
+				}
+			}
 			continue
 		}
 
-		structFieldKind := structField.Kind()
 		inputFieldName := fd.name
 		if inputFieldName == "" {
 			inputFieldName = typeField.Name
 
-			// if "form" tag is nil, we inspect if the field is a struct.
+			// if the tag is nil, we inspect if the field is a struct.
 			// this would not make sense for JSON parsing but it does for a form
 			// since data is flatten
-			if structFieldKind == reflect.Struct {
-				err := mapForm(structField.Addr().Interface(), form)
-				if err != nil {
+			if fd.kind == kindStruct {
+				if err := mapStruct(structField, src, tag, prefix); err != nil {
 					return err
 				}
 				continue
 			}
+			if tag != "form" {
+				continue
+			}
 		}
-		inputValue, exists := form[inputFieldName]
-		if !exists {
-			// Set the field as default value when the input value is not exist
-			if fd.hasDefault {
+		key := prefix + inputFieldName
+
+		switch {
+		case fd.kind == kindStruct:
+			if !nested {
+				continue
+			}
+			if err := mapStruct(structField, src, tag, key+"."); err != nil {
+				return err
+			}
+			continue
+		case fd.kind == kindPtrStruct && nested:
+			if len(form.suffixes(key+".")) == 0 {
+				continue
+			}
+			if structField.IsNil() {
+				structField.Set(reflect.New(typeField.Type.Elem()))
+			}
+			if err := mapStruct(structField.Elem(), src, tag, key+"."); err != nil {
+				return err
+			}
+			continue
+		case fd.kind == kindSliceStruct && nested:
+			if err := mapSliceStruct(structField, form, tag, key+"."); err != nil {
+				return err
+			}
+			continue
+		case fd.kind == kindMap && nested:
+			if err := mapMap(structField, form, tag, key+".", fd); err != nil {
+				return err
+			}
+			continue
+		}
+
+		inputValue, exists := src.lookup(key)
+		if !exists || len(inputValue) == 0 {
+			// Set the field as default value when the input value is not
+			// exist, unless an earlier source has filled it
+			if fd.hasDefault && structField.IsZero() {
 				structField.Set(fd.defaultValue)
 			}
 			continue
@@ -106,85 +356,202 @@ func mapForm(ptr interface{}, form map[string][]string) error {
 			structField.Set(fd.defaultValue)
 			continue
 		}
-		if _, isTime := structField.Interface().(time.Time); isTime {
-			if err := setTimeField(inputValue[0], typeField, structField); err != nil {
+		if err := setWithProperType(inputValue, structField, typeField, fd.option); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapSliceStruct fills a slice of structs from indexed keys. Indexes only
+// order the elements, items[3] and items[7] make a slice of two.
+func mapSliceStruct(field reflect.Value, form formSource, tag, prefix string) error {
+	var idx []int
+	for _, s := range form.suffixes(prefix) {
+		i, err := strconv.Atoi(s)
+		if err != nil || i < 0 {
+			return errors.Errorf("invalid index %q in %s", s, strings.TrimSuffix(prefix, "."))
+		}
+		idx = append(idx, i)
+	}
+	if len(idx) == 0 {
+		return nil
+	}
+	sort.Ints(idx)
+
+	slice := reflect.MakeSlice(field.Type(), len(idx), len(idx))
+	for n, i := range idx {
+		if err := mapStruct(slice.Index(n), form, tag, prefix+strconv.Itoa(i)+"."); err != nil {
+			return err
+		}
+	}
+	field.Set(slice)
+	return nil
+}
+
+// mapMap fills a map[string]T from the keys under prefix, T may be a
+// struct or a pointer to one mapped like a nested field.
+func mapMap(value reflect.Value, form formSource, tag, prefix string, fd *field) error {
+	keys := form.suffixes(prefix)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	tp := value.Type()
+	m := value
+	if m.IsNil() {
+		m = reflect.MakeMapWithSize(tp, len(keys))
+	}
+	for _, k := range keys {
+		elem := reflect.New(tp.Elem()).Elem()
+		switch kindOf(tp.Elem()) {
+		case kindStruct:
+			if err := mapStruct(elem, form, tag, prefix+k+"."); err != nil {
 				return err
 			}
+		case kindPtrStruct:
+			elem.Set(reflect.New(tp.Elem().Elem()))
+			if err := mapStruct(elem.Elem(), form, tag, prefix+k+"."); err != nil {
+				return err
+			}
+		default:
+			vs, ok := form[prefix+k]
+			if !ok || len(vs) == 0 {
+				continue
+			}
+			if err := setWithProperType(vs, elem, fd.tp, fd.option); err != nil {
+				return err
+			}
+		}
+		m.SetMapIndex(reflect.ValueOf(unbracket(k)).Convert(tp.Key()), elem)
+	}
+	value.Set(m)
+	return nil
+}
+
+// mapRemain fills a catch-all map[string]T with the form keys under prefix
+// that no other field of sinfo takes.
+func mapRemain(value reflect.Value, form formSource, sinfo *sinfo, prefix string, fd *field) error {
+	tp := value.Type()
+	m := value
+	for k, vs := range form {
+		if !strings.HasPrefix(k, prefix) || len(vs) == 0 {
+			continue
+		}
+		rest := k[len(prefix):]
+		if sinfo.names[segment(rest)] {
 			continue
 		}
-		if err := setWithProperType(typeField.Type.Kind(), inputValue, structField, fd.option); err != nil {
+		elem := reflect.New(tp.Elem()).Elem()
+		if err := setWithProperType(vs, elem, fd.tp, fd.option); err != nil {
 			return err
 		}
+		if m.IsNil() {
+			m = reflect.MakeMap(tp)
+		}
+		m.SetMapIndex(reflect.ValueOf(unbracket(rest)).Convert(tp.Key()), elem)
 	}
+	value.Set(m)
 	return nil
 }
 
-func setWithProperType(valueKind reflect.Kind, val []string, structField reflect.Value, option tagOptions) error {
-	switch valueKind {
-	case reflect.Int:
-		return setIntField(val[0], 0, structField)
-	case reflect.Int8:
-		return setIntField(val[0], 8, structField)
-	case reflect.Int16:
-		return setIntField(val[0], 16, structField)
-	case reflect.Int32:
-		return setIntField(val[0], 32, structField)
-	case reflect.Int64:
-		return setIntField(val[0], 64, structField)
-	case reflect.Uint:
-		return setUintField(val[0], 0, structField)
-	case reflect.Uint8:
-		return setUintField(val[0], 8, structField)
-	case reflect.Uint16:
-		return setUintField(val[0], 16, structField)
-	case reflect.Uint32:
-		return setUintField(val[0], 32, structField)
-	case reflect.Uint64:
-		return setUintField(val[0], 64, structField)
-	case reflect.Bool:
-		return setBoolField(val[0], structField)
-	case reflect.Float32:
-		return setFloatField(val[0], 32, structField)
-	case reflect.Float64:
-		return setFloatField(val[0], 64, structField)
-	case reflect.String:
-		structField.SetString(val[0])
+// setWithProperType sets value from val, field holds the tags of the
+// struct field value belongs to.
+func setWithProperType(val []string, value reflect.Value, field reflect.StructField, option tagOptions) error {
+	tp := value.Type()
+	if isCustom(tp) {
+		return setScalar(val[0], value, field)
+	}
+	switch tp.Kind() {
+	case reflect.Ptr:
+		// pointers are only set when there is a value, absent ones stay nil
+		elem := reflect.New(tp.Elem())
+		if err := setWithProperType(val, elem.Elem(), field, option); err != nil {
+			return err
+		}
+		value.Set(elem)
 	case reflect.Slice:
-		if option.Contains("split") {
-			val = strings.Split(val[0], ",")
-		}
-		filtered := filterEmpty(val)
-		switch structField.Type().Elem().Kind() {
-		case reflect.Int64:
-			valSli := make([]int64, 0, len(filtered))
-			for i := 0; i < len(filtered); i++ {
-				d, err := strconv.ParseInt(filtered[i], 10, 64)
-				if err != nil {
-					return err
-				}
-				valSli = append(valSli, d)
-			}
-			structField.Set(reflect.ValueOf(valSli))
-		case reflect.String:
-			valSli := make([]string, 0, len(filtered))
-			for i := 0; i < len(filtered); i++ {
-				valSli = append(valSli, filtered[i])
+		if tp.Elem().Kind() == reflect.Uint8 && !isCustom(tp.Elem()) {
+			return setBytesField(val[0], value)
+		}
+		val = splitValues(val, option)
+		slice := reflect.MakeSlice(tp, len(val), len(val))
+		for i, v := range val {
+			if err := setScalar(v, slice.Index(i), field); err != nil {
+				return err
 			}
-			structField.Set(reflect.ValueOf(valSli))
-		default:
-			sliceOf := structField.Type().Elem().Kind()
-			numElems := len(filtered)
-			slice := reflect.MakeSlice(structField.Type(), len(filtered), len(filtered))
-			for i := 0; i < numElems; i++ {
-				if err := setWithProperType(sliceOf, filtered[i:], slice.Index(i), ""); err != nil {
-					return err
-				}
+		}
+		value.Set(slice)
+	case reflect.Array:
+		val = splitValues(val, option)
+		if len(val) > tp.Len() {
+			return errors.Errorf("%d values for %s", len(val), tp)
+		}
+		array := reflect.New(tp).Elem()
+		for i, v := range val {
+			if err := setScalar(v, array.Index(i), field); err != nil {
+				return err
 			}
-			structField.Set(slice)
 		}
+		value.Set(array)
+	default:
+		return setScalar(val[0], value, field)
+	}
+	return nil
+}
+
+func setScalar(val string, value reflect.Value, field reflect.StructField) error {
+	if value.Type() == timeType {
+		return setTimeField(val, field, value)
+	}
+	if ok, err := setCustom(val, value); ok {
+		return err
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return setIntField(val, value.Type().Bits(), value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return setUintField(val, value.Type().Bits(), value)
+	case reflect.Bool:
+		return setBoolField(val, value)
+	case reflect.Float32, reflect.Float64:
+		return setFloatField(val, value.Type().Bits(), value)
+	case reflect.String:
+		value.SetString(val)
+	case reflect.Ptr:
+		elem := reflect.New(value.Type().Elem())
+		if err := setScalar(val, elem.Elem(), field); err != nil {
+			return err
+		}
+		value.Set(elem)
 	default:
-		return errors.New("Unknown type")
+		return errors.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// splitValues splits every value at commas for the split option and drops
+// empty ones.
+func splitValues(val []string, option tagOptions) []string {
+	if option.Contains("split") {
+		var all []string
+		for _, v := range val {
+			all = append(all, strings.Split(v, ",")...)
+		}
+		val = all
 	}
+	return filterEmpty(val)
+}
+
+// setBytesField decodes a []byte from standard or URL-safe base64.
+func setBytesField(val string, value reflect.Value) error {
+	b, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		if b, err = base64.URLEncoding.DecodeString(val); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	value.SetBytes(b)
 	return nil
 }
 
@@ -218,7 +585,7 @@ func setBoolField(val string, field reflect.Value) error {
 	if err == nil {
 		field.SetBool(boolVal)
 	}
-	return nil
+	return errors.WithStack(err)
 }
 
 func setFloatField(val string, bitSize int, field reflect.Value) error {
@@ -0,0 +1,206 @@
+package binding
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappingCollections(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", s, time.UTC)
+		return d
+	}
+
+	tests := []struct {
+		name string
+		form map[string][]string
+		obj  any
+		want any
+	}{
+		{"bools", map[string][]string{"v": {"true", "0", "1"}}, new(struct {
+			V []bool `form:"v"`
+		}), &struct {
+			V []bool `form:"v"`
+		}{[]bool{true, false, true}}},
+		{"floats", map[string][]string{"v": {"1.5", "-2"}}, new(struct {
+			V []float64 `form:"v"`
+		}), &struct {
+			V []float64 `form:"v"`
+		}{[]float64{1.5, -2}}},
+		{"float32s split", map[string][]string{"v": {"1.5,2.5"}}, new(struct {
+			V []float32 `form:"v,split"`
+		}), &struct {
+			V []float32 `form:"v,split"`
+		}{[]float32{1.5, 2.5}}},
+		{"ints", map[string][]string{"v": {"1", "2"}}, new(struct {
+			V []int8 `form:"v"`
+		}), &struct {
+			V []int8 `form:"v"`
+		}{[]int8{1, 2}}},
+		{"uints", map[string][]string{"v": {"7", "8"}}, new(struct {
+			V []uint16 `form:"v"`
+		}), &struct {
+			V []uint16 `form:"v"`
+		}{[]uint16{7, 8}}},
+		{"int64s", map[string][]string{"v": {"9"}}, new(struct {
+			V []int64 `form:"v"`
+		}), &struct {
+			V []int64 `form:"v"`
+		}{[]int64{9}}},
+		{"strings skip empty", map[string][]string{"v": {"a", "", "b"}}, new(struct {
+			V []string `form:"v"`
+		}), &struct {
+			V []string `form:"v"`
+		}{[]string{"a", "b"}}},
+		{"named slice", map[string][]string{"v": {"a", "b"}}, new(struct {
+			V testNames `form:"v"`
+		}), &struct {
+			V testNames `form:"v"`
+		}{testNames{"a", "b"}}},
+		{"pointer elems", map[string][]string{"v": {"3"}}, new(struct {
+			V []*int `form:"v"`
+		}), &struct {
+			V []*int `form:"v"`
+		}{[]*int{intPtr(3)}}},
+		{"array", map[string][]string{"v": {"1", "2"}}, new(struct {
+			V [3]int `form:"v"`
+		}), &struct {
+			V [3]int `form:"v"`
+		}{[3]int{1, 2, 0}}},
+		{"array split", map[string][]string{"v": {"x,y"}}, new(struct {
+			V [2]string `form:"v,split"`
+		}), &struct {
+			V [2]string `form:"v,split"`
+		}{[2]string{"x", "y"}}},
+		{"times", map[string][]string{"v": {"2022-01-02", "2022-03-04"}}, new(struct {
+			V []time.Time `form:"v" time_format:"2006-01-02" time_utc:"1"`
+		}), &struct {
+			V []time.Time `form:"v" time_format:"2006-01-02" time_utc:"1"`
+		}{[]time.Time{day("2022-01-02"), day("2022-03-04")}}},
+		{"time pointer", map[string][]string{"v": {"2022-01-02"}}, new(struct {
+			V *time.Time `form:"v" time_format:"2006-01-02" time_utc:"1"`
+		}), &struct {
+			V *time.Time `form:"v" time_format:"2006-01-02" time_utc:"1"`
+		}{timePtr(day("2022-01-02"))}},
+		{"bytes", map[string][]string{"v": {"aGVsbG8="}}, new(struct {
+			V []byte `form:"v"`
+		}), &struct {
+			V []byte `form:"v"`
+		}{[]byte("hello")}},
+		{"bytes url-safe", map[string][]string{"v": {"__8="}}, new(struct {
+			V []byte `form:"v"`
+		}), &struct {
+			V []byte `form:"v"`
+		}{[]byte{0xff, 0xff}}},
+		{"map of slices", map[string][]string{"v[a]": {"1", "2"}}, new(struct {
+			V map[string][]int `form:"v"`
+		}), &struct {
+			V map[string][]int `form:"v"`
+		}{map[string][]int{"a": {1, 2}}}},
+		{"map keys with dots", map[string][]string{"v[color.dark]": {"x"}, "v[size]": {"l"}}, new(struct {
+			V map[string]string `form:"v"`
+		}), &struct {
+			V map[string]string `form:"v"`
+		}{map[string]string{"color.dark": "x", "size": "l"}}},
+		{"map of struct pointers", map[string][]string{"v[a][n]": {"1"}, "v[b.c][n]": {"2"}}, new(struct {
+			V map[string]*testItem `form:"v"`
+		}), &struct {
+			V map[string]*testItem `form:"v"`
+		}{map[string]*testItem{"a": {N: 1}, "b.c": {N: 2}}}},
+		{"remain strings", map[string][]string{"name": {"n"}, "x": {"1", "2"}, "y.z": {"3"}}, new(struct {
+			Name  string            `form:"name"`
+			Extra map[string]string `form:",remain"`
+		}), &struct {
+			Name  string            `form:"name"`
+			Extra map[string]string `form:",remain"`
+		}{"n", map[string]string{"x": "1", "y.z": "3"}}},
+		{"remain slices", map[string][]string{"name": {"n"}, "x": {"1", "2"}}, new(struct {
+			Name  string              `form:"name"`
+			Extra map[string][]string `form:",remain"`
+		}), &struct {
+			Name  string              `form:"name"`
+			Extra map[string][]string `form:",remain"`
+		}{"n", map[string][]string{"x": {"1", "2"}}}},
+		{"remain nested", map[string][]string{"in[a]": {"1"}, "in[b]": {"2"}}, new(struct {
+			In struct {
+				A    string            `form:"a"`
+				Rest map[string]string `form:",remain"`
+			} `form:"in"`
+		}), &struct {
+			In struct {
+				A    string            `form:"a"`
+				Rest map[string]string `form:",remain"`
+			} `form:"in"`
+		}{struct {
+			A    string            `form:"a"`
+			Rest map[string]string `form:",remain"`
+		}{"1", map[string]string{"b": "2"}}}},
+		{"remain keys with dots", map[string][]string{"in[a]": {"1"}, "in[b.c]": {"2"}}, new(struct {
+			In struct {
+				A    string            `form:"a"`
+				Rest map[string]string `form:",remain"`
+			} `form:"in"`
+		}), &struct {
+			In struct {
+				A    string            `form:"a"`
+				Rest map[string]string `form:",remain"`
+			} `form:"in"`
+		}{struct {
+			A    string            `form:"a"`
+			Rest map[string]string `form:",remain"`
+		}{"1", map[string]string{"b.c": "2"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Nil(t, mapForm(tt.obj, tt.form))
+			assert.Equal(t, tt.obj, tt.want)
+		})
+	}
+}
+
+func TestMappingCollectionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		form map[string][]string
+		obj  any
+	}{
+		{"bad float", map[string][]string{"v": {"x"}}, new(struct {
+			V []float64 `form:"v"`
+		})},
+		{"bad bool", map[string][]string{"v": {"yes"}}, new(struct {
+			V []bool `form:"v"`
+		})},
+		{"overflow", map[string][]string{"v": {"70000"}}, new(struct {
+			V []uint16 `form:"v"`
+		})},
+		{"array too short", map[string][]string{"v": {"1", "2", "3"}}, new(struct {
+			V [2]int `form:"v"`
+		})},
+		{"bad base64", map[string][]string{"v": {"!!"}}, new(struct {
+			V []byte `form:"v"`
+		})},
+		{"time without format", map[string][]string{"v": {"2022-01-02"}}, new(struct {
+			V []time.Time `form:"v"`
+		})},
+		{"unsupported", map[string][]string{"v": {"1"}}, new(struct {
+			V []chan int `form:"v"`
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, mapForm(tt.obj, tt.form))
+		})
+	}
+}
+
+type testItem struct {
+	N int `form:"n"`
+}
+
+type testNames []string
+
+func intPtr(i int) *int { return &i }
+
+func timePtr(t time.Time) *time.Time { return &t }
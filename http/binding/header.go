@@ -0,0 +1,37 @@
+package binding
+
+import "net/http"
+
+type headerBinding struct{}
+
+func (headerBinding) Name() string {
+	return "header"
+}
+
+func (h headerBinding) Bind(req *http.Request, obj interface{}) error {
+	if err := h.Decode(req, obj); err != nil {
+		return err
+	}
+	return validate(req, obj, FieldTag("header"))
+}
+
+func (headerBinding) Decode(req *http.Request, obj interface{}) error {
+	return mapping(obj, headerSource(req.Header), "header")
+}
+
+type cookieBinding struct{}
+
+func (cookieBinding) Name() string {
+	return "cookie"
+}
+
+func (c cookieBinding) Bind(req *http.Request, obj interface{}) error {
+	if err := c.Decode(req, obj); err != nil {
+		return err
+	}
+	return validate(req, obj, FieldTag("cookie"))
+}
+
+func (cookieBinding) Decode(req *http.Request, obj interface{}) error {
+	return mapping(obj, cookieSource{req}, "cookie")
+}
@@ -3,8 +3,6 @@ package binding
 import (
 	"encoding/json"
 	"net/http"
-
-	"github.com/pkg/errors"
 )
 
 type jsonBinding struct{}
@@ -13,10 +11,17 @@ func (jsonBinding) Name() string {
 	return "json"
 }
 
-func (jsonBinding) Bind(req *http.Request, obj interface{}) error {
+func (j jsonBinding) Bind(req *http.Request, obj interface{}) error {
+	if err := j.Decode(req, obj); err != nil {
+		return err
+	}
+	return validate(req, obj)
+}
+
+func (jsonBinding) Decode(req *http.Request, obj interface{}) error {
 	decoder := json.NewDecoder(req.Body)
 	if err := decoder.Decode(obj); err != nil {
-		return errors.WithStack(err)
+		return bodyError(err)
 	}
-	return validate(obj)
+	return nil
 }
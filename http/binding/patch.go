@@ -0,0 +1,526 @@
+package binding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrTestFailed is the error of a JSON Patch test operation whose value
+	// does not match.
+	ErrTestFailed = errors.New("test failed")
+
+	// ErrInvalidPath is the error of a JSON Patch operation whose path or
+	// from is malformed or points to a missing location.
+	ErrInvalidPath = errors.New("invalid path")
+
+	// ErrInvalidOperation is the error of a malformed JSON Patch
+	// operation, like an unknown op or a missing value.
+	ErrInvalidOperation = errors.New("invalid operation")
+)
+
+// PatchError reports a patch that cannot be applied. Index is the position
+// of the failed JSON Patch operation, or -1 for a merge patch and for a
+// patched document that does not fit the target value.
+type PatchError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *PatchError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("patch: %v", e.Err)
+	}
+	return fmt.Sprintf("patch operation %d (%s %q): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode is 409 Conflict for a failed test and 422 otherwise.
+func (e *PatchError) StatusCode() int {
+	if errors.Is(e.Err, ErrTestFailed) {
+		return http.StatusConflict
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// mergePatchBinding applies an RFC 7396 JSON Merge Patch to obj, which
+// holds the current value.
+type mergePatchBinding struct{}
+
+func (mergePatchBinding) Name() string {
+	return "merge-patch"
+}
+
+func (m mergePatchBinding) Bind(req *http.Request, obj interface{}) error {
+	return m.DecodeValidate(req, obj, func(v interface{}) error {
+		return validate(req, v)
+	})
+}
+
+func (m mergePatchBinding) Decode(req *http.Request, obj interface{}) error {
+	return m.DecodeValidate(req, obj, nil)
+}
+
+func (mergePatchBinding) DecodeValidate(req *http.Request, obj interface{}, check func(interface{}) error) error {
+	var patch any
+	if err := decodeJSON(req.Body, &patch); err != nil {
+		return err
+	}
+	return patchValue(obj, func(doc any) (any, error) {
+		return mergePatch(doc, patch), nil
+	}, check)
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// jsonPatchBinding applies an RFC 6902 JSON Patch to obj, which holds the
+// current value. The operations are applied all or nothing.
+type jsonPatchBinding struct{}
+
+func (jsonPatchBinding) Name() string {
+	return "json-patch"
+}
+
+func (j jsonPatchBinding) Bind(req *http.Request, obj interface{}) error {
+	return j.DecodeValidate(req, obj, func(v interface{}) error {
+		return validate(req, v)
+	})
+}
+
+func (j jsonPatchBinding) Decode(req *http.Request, obj interface{}) error {
+	return j.DecodeValidate(req, obj, nil)
+}
+
+func (jsonPatchBinding) DecodeValidate(req *http.Request, obj interface{}, check func(interface{}) error) error {
+	var ops []map[string]json.RawMessage
+	if err := decodeJSON(req.Body, &ops); err != nil {
+		return err
+	}
+	return patchValue(obj, func(doc any) (any, error) {
+		for i, op := range ops {
+			var err error
+			if doc, err = applyOp(doc, i, op); err != nil {
+				return nil, err
+			}
+		}
+		return doc, nil
+	}, check)
+}
+
+func applyOp(doc any, i int, raw map[string]json.RawMessage) (any, error) {
+	var op, path, from string
+	var value any
+	_, hasValue := raw["value"]
+	err := firstErr(
+		decodeField(raw, "op", &op),
+		decodeField(raw, "path", &path),
+		decodeField(raw, "from", &from),
+		decodeField(raw, "value", &value),
+	)
+	fail := func(err error) (any, error) {
+		return nil, &PatchError{Index: i, Op: op, Path: path, Err: err}
+	}
+	if err != nil {
+		return fail(errors.Wrap(ErrInvalidOperation, err.Error()))
+	}
+	if _, ok := raw["path"]; !ok {
+		return fail(errors.Wrap(ErrInvalidOperation, "missing path"))
+	}
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return fail(err)
+	}
+
+	switch op {
+	case "add", "replace", "test":
+		if !hasValue {
+			return fail(errors.Wrap(ErrInvalidOperation, "missing value"))
+		}
+	case "move", "copy":
+		if _, ok := raw["from"]; !ok {
+			return fail(errors.Wrap(ErrInvalidOperation, "missing from"))
+		}
+	}
+
+	switch op {
+	case "add":
+		doc, err = addValue(doc, tokens, value)
+	case "remove":
+		doc, _, err = removeValue(doc, tokens)
+	case "replace":
+		if _, err = getValue(doc, tokens); err == nil {
+			doc, err = replaceValue(doc, tokens, value)
+		}
+	case "move":
+		var ft []string
+		if ft, err = parsePointer(from); err != nil {
+			break
+		}
+		if strings.HasPrefix(path, from+"/") {
+			err = errors.Wrap(ErrInvalidPath, "cannot move a value into itself")
+			break
+		}
+		var v any
+		if doc, v, err = removeValue(doc, ft); err == nil {
+			doc, err = addValue(doc, tokens, v)
+		}
+	case "copy":
+		var ft []string
+		var v any
+		if ft, err = parsePointer(from); err != nil {
+			break
+		}
+		if v, err = getValue(doc, ft); err == nil {
+			doc, err = addValue(doc, tokens, deepCopy(v))
+		}
+	case "test":
+		var v any
+		if v, err = getValue(doc, tokens); err == nil && !jsonEqual(v, value) {
+			err = ErrTestFailed
+		}
+	default:
+		err = errors.Wrapf(ErrInvalidOperation, "unknown op %q", op)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return doc, nil
+}
+
+// patchValue marshals obj, patches the document with fn and unmarshals the
+// result into a copy of obj, which is stored in obj once check, if not nil,
+// accepts it. obj is left untouched when any step fails.
+func patchValue(obj interface{}, fn func(doc any) (any, error), check func(interface{}) error) error {
+	ptr := reflect.ValueOf(obj)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return errors.Errorf("patch target must be a non-nil pointer, got %T", obj)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var doc any
+	if err = decodeJSON(bytes.NewReader(data), &doc); err != nil {
+		return err
+	}
+	if doc, err = fn(doc); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(doc); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// unmarshal into a copy whose JSON fields are reset, so removed members
+	// end up zero and fields hidden from JSON keep their value.
+	cp := reflect.New(ptr.Elem().Type())
+	cp.Elem().Set(ptr.Elem())
+	resetJSON(cp.Elem())
+	if err = json.Unmarshal(data, cp.Interface()); err != nil {
+		return &PatchError{Index: -1, Err: err}
+	}
+	if check != nil {
+		if err = check(cp.Interface()); err != nil {
+			return err
+		}
+	}
+	ptr.Elem().Set(cp.Elem())
+	return nil
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// resetJSON zeroes the parts of v that encoding/json writes.
+func resetJSON(v reflect.Value) {
+	tp := v.Type()
+	if tp.Kind() != reflect.Struct || reflect.PtrTo(tp).Implements(jsonUnmarshalerType) || reflect.PtrTo(tp).Implements(textUnmarshalerType) {
+		v.Set(reflect.Zero(tp))
+		return
+	}
+	for i := 0; i < tp.NumField(); i++ {
+		fd := tp.Field(i)
+		if !fd.IsExported() && !fd.Anonymous || fd.Tag.Get("json") == "-" {
+			continue
+		}
+		if f := v.Field(i); f.CanSet() {
+			resetJSON(f)
+		} else if f.Kind() == reflect.Struct {
+			// unexported embedded struct, its exported fields are promoted
+			resetJSON(reflect.NewAt(f.Type(), f.Addr().UnsafePointer()).Elem())
+		}
+	}
+}
+
+func decodeJSON(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return bodyError(err)
+	}
+	return nil
+}
+
+func decodeField(raw map[string]json.RawMessage, name string, v any) error {
+	data, ok := raw[name]
+	if !ok {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return errors.Wrap(dec.Decode(v), name)
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped tokens.
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if path[0] != '/' {
+		return nil, errors.Wrapf(ErrInvalidPath, "%q does not start with /", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token, end allows the index one past
+// the last element.
+func arrayIndex(token string, n int, end bool) (int, error) {
+	if token == "-" && end {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || token != strconv.Itoa(i) {
+		return 0, errors.Wrapf(ErrInvalidPath, "bad array index %q", token)
+	}
+	if i > n || i == n && !end {
+		return 0, errors.Wrapf(ErrInvalidPath, "array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func getValue(doc any, tokens []string) (any, error) {
+	for _, t := range tokens {
+		switch n := doc.(type) {
+		case map[string]any:
+			v, ok := n[t]
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalidPath, "member %q not found", t)
+			}
+			doc = v
+		case []any:
+			i, err := arrayIndex(t, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = n[i]
+		default:
+			return nil, errors.Wrapf(ErrInvalidPath, "%q not found", t)
+		}
+	}
+	return doc, nil
+}
+
+// modify calls fn with the container holding the last token and stores the
+// container fn returns in its parent.
+func modify(doc any, tokens []string, fn func(node any, key string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	switch n := doc.(type) {
+	case map[string]any:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidPath, "member %q not found", tokens[0])
+		}
+		c, err := modify(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = c
+		return n, nil
+	case []any:
+		i, err := arrayIndex(tokens[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		c, err := modify(n[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = c
+		return n, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidPath, "%q not found", tokens[0])
+}
+
+func addValue(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return modify(doc, tokens, func(node any, key string) (any, error) {
+		switch n := node.(type) {
+		case map[string]any:
+			n[key] = value
+			return n, nil
+		case []any:
+			i, err := arrayIndex(key, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		return nil, errors.Wrapf(ErrInvalidPath, "cannot add %q to a scalar", key)
+	})
+}
+
+func removeValue(doc any, tokens []string) (any, any, error) {
+	if len(tokens) == 0 {
+		return nil, nil, errors.Wrap(ErrInvalidPath, "cannot remove the whole document")
+	}
+	var removed any
+	doc, err := modify(doc, tokens, func(node any, key string) (any, error) {
+		switch n := node.(type) {
+		case map[string]any:
+			v, ok := n[key]
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalidPath, "member %q not found", key)
+			}
+			removed = v
+			delete(n, key)
+			return n, nil
+		case []any:
+			i, err := arrayIndex(key, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = n[i]
+			return append(n[:i], n[i+1:]...), nil
+		}
+		return nil, errors.Wrapf(ErrInvalidPath, "%q not found", key)
+	})
+	return doc, removed, err
+}
+
+func replaceValue(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return modify(doc, tokens, func(node any, key string) (any, error) {
+		switch n := node.(type) {
+		case map[string]any:
+			n[key] = value
+			return n, nil
+		case []any:
+			i, err := arrayIndex(key, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			n[i] = value
+			return n, nil
+		}
+		return nil, errors.Wrapf(ErrInvalidPath, "%q not found", key)
+	})
+}
+
+func deepCopy(v any) any {
+	switch n := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(n))
+		for k, e := range n {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []any:
+		s := make([]any, len(n))
+		for i, e := range n {
+			s[i] = deepCopy(e)
+		}
+		return s
+	}
+	return v
+}
+
+// jsonEqual compares two decoded documents, numbers by value.
+func jsonEqual(a, b any) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, errx := x.Float64()
+		fy, erry := y.Float64()
+		return errx == nil && erry == nil && fx == fy
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
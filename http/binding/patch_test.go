@@ -0,0 +1,142 @@
+package binding
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type testDoc struct {
+	Title  string            `json:"title" validate:"required"`
+	Author *testAuthor       `json:"author,omitempty"`
+	Tags   []string          `json:"tags"`
+	Meta   map[string]string `json:"meta,omitempty"`
+	Secret string            `json:"-"`
+}
+
+type testAuthor struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+func TestMergePatchBinding(t *testing.T) {
+	doc := &testDoc{
+		Title:  "Goodbye!",
+		Author: &testAuthor{Name: "John", Email: "j@x.org"},
+		Tags:   []string{"example", "sample"},
+		Secret: "keep",
+	}
+	req := requestWithBody("PATCH", "/", MIME_MergePatch, `{"title":"Hello!","author":{"email":null},"tags":["example"],"meta":{"phone":"1"}}`)
+	assert.Nil(t, MergePatch.Bind(req, doc))
+	assert.Equal(t, doc, &testDoc{
+		Title:  "Hello!",
+		Author: &testAuthor{Name: "John"},
+		Tags:   []string{"example"},
+		Meta:   map[string]string{"phone": "1"},
+		Secret: "keep",
+	})
+
+	req = requestWithBody("PATCH", "/", MIME_MergePatch, `{"title":null}`)
+	assert.Error(t, MergePatch.Bind(req, doc))
+	assert.Equal(t, doc.Title, "Hello!")
+
+	req = requestWithBody("PATCH", "/", MIME_MergePatch, `{"title":5}`)
+	var pe *PatchError
+	assert.True(t, errors.As(MergePatch.Bind(req, doc), &pe))
+	assert.Equal(t, pe.Index, -1)
+	assert.Equal(t, doc.Title, "Hello!")
+}
+
+func TestMergePatch(t *testing.T) {
+	// examples of RFC 7396 appendix A
+	tests := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		var target any
+		assert.Nil(t, json.Unmarshal([]byte(tt.target), &target))
+		req := requestWithBody("PATCH", "/", MIME_MergePatch, tt.patch)
+		assert.Nil(t, MergePatch.Decode(req, &target))
+		got, _ := json.Marshal(target)
+		assert.Equal(t, string(got), tt.want, tt.patch)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	// examples of RFC 6902 appendix A
+	tests := []struct{ doc, patch, want string }{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"child":{"grandchild":{}},"foo":"bar"}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"foo":null}`, `[{"op":"test","path":"/foo","value":null}]`, `{"foo":null}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"copy","from":"/~1","path":"/a"}]`, `{"/":9,"a":9,"~1":10}`},
+		{`{"a":{"b":[1]}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/0","value":0}]`, `{"a":{"b":[1]},"c":{"b":[0,1]}}`},
+		{`{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+	for _, tt := range tests {
+		var doc any
+		assert.Nil(t, json.Unmarshal([]byte(tt.doc), &doc))
+		req := requestWithBody("PATCH", "/", MIME_JSONPatch, tt.patch)
+		assert.Nil(t, JSONPatch.Decode(req, &doc), tt.patch)
+		got, _ := json.Marshal(doc)
+		assert.Equal(t, string(got), tt.want, tt.patch)
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		patch string
+		index int
+		err   error
+		code  int
+	}{
+		{`[{"op":"replace","path":"/title","value":"x"},{"op":"test","path":"/title","value":"y"}]`, 1, ErrTestFailed, http.StatusConflict},
+		{`[{"op":"replace","path":"/missing","value":1}]`, 0, ErrInvalidPath, http.StatusUnprocessableEntity},
+		{`[{"op":"add","path":"/tags/5","value":"x"}]`, 0, ErrInvalidPath, http.StatusUnprocessableEntity},
+		{`[{"op":"add","path":"title","value":"x"}]`, 0, ErrInvalidPath, http.StatusUnprocessableEntity},
+		{`[{"op":"remove","path":"/tags/01"}]`, 0, ErrInvalidPath, http.StatusUnprocessableEntity},
+		{`[{"op":"move","from":"/author","path":"/author/name"}]`, 0, ErrInvalidPath, http.StatusUnprocessableEntity},
+		{`[{"op":"add","path":"/title"}]`, 0, ErrInvalidOperation, http.StatusUnprocessableEntity},
+		{`[{"op":"rename","path":"/title"}]`, 0, ErrInvalidOperation, http.StatusUnprocessableEntity},
+		{`[{"op":"copy","path":"/a"}]`, 0, ErrInvalidOperation, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		doc := &testDoc{Title: "Hello!", Author: &testAuthor{Name: "John"}, Tags: []string{"a"}}
+		req := requestWithBody("PATCH", "/", MIME_JSONPatch, tt.patch)
+		err := JSONPatch.Bind(req, doc)
+		var pe *PatchError
+		assert.True(t, errors.As(err, &pe), tt.patch)
+		assert.Equal(t, pe.Index, tt.index, tt.patch)
+		assert.ErrorIs(t, err, tt.err, tt.patch)
+		assert.Equal(t, pe.StatusCode(), tt.code, tt.patch)
+		assert.Equal(t, doc.Title, "Hello!")
+	}
+
+	req := requestWithBody("PATCH", "/", MIME_JSONPatch, `[{"op":"replace","path":"/title","value":""}]`)
+	doc := &testDoc{Title: "Hello!"}
+	assert.Equal(t, JSONPatch.Bind(req, doc), Errors{"title": "title is a required field"})
+	assert.Error(t, JSONPatch.Bind(requestWithBody("PATCH", "/", MIME_JSONPatch, `{"op":"add"}`), doc))
+}
@@ -8,10 +8,13 @@ func (queryBinding) Name() string {
 	return "query"
 }
 
-func (queryBinding) Validate(req *http.Request, obj interface{}) error {
-	values := req.URL.Query()
-	if err := mapForm(obj, values); err != nil {
+func (q queryBinding) Bind(req *http.Request, obj interface{}) error {
+	if err := q.Decode(req, obj); err != nil {
 		return err
 	}
-	return validate(obj)
+	return validate(req, obj, FieldTag("form"))
+}
+
+func (queryBinding) Decode(req *http.Request, obj interface{}) error {
+	return mapForm(obj, req.URL.Query())
 }
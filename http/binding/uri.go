@@ -0,0 +1,30 @@
+package binding
+
+// Params are the route params of a request.
+type Params interface {
+	ByName(name string) string
+}
+
+// UriBinding binds route params to fields tagged `uri`.
+type UriBinding interface {
+	Name() string
+	BindUri(Params, interface{}) error
+	DecodeUri(Params, interface{}) error
+}
+
+type uriBinding struct{}
+
+func (uriBinding) Name() string {
+	return "uri"
+}
+
+func (u uriBinding) BindUri(ps Params, obj interface{}) error {
+	if err := u.DecodeUri(ps, obj); err != nil {
+		return err
+	}
+	return validate(nil, obj, FieldTag("uri"))
+}
+
+func (uriBinding) DecodeUri(ps Params, obj interface{}) error {
+	return mapping(obj, paramSource{ps}, "uri")
+}
@@ -0,0 +1,613 @@
+package binding
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	zh_translations "github.com/go-playground/validator/v10/translations/zh"
+	"github.com/pkg/errors"
+)
+
+// StructValidator validates bound values. Each Engine has its own, so
+// rules registered on one do not leak into another.
+type StructValidator interface {
+	// ValidateStruct validates a struct, a pointer to one, or a slice,
+	// array or map of them. Other values are valid.
+	ValidateStruct(obj any) error
+
+	// RegisterValidation adds a rule used as `validate:"tag"`.
+	RegisterValidation(tag string, fn validator.Func, callValidationEvenIfNull ...bool) error
+
+	// RegisterStructValidation adds a rule checking a whole struct of
+	// each of types, for constraints across several fields.
+	RegisterStructValidation(fn validator.StructLevelFunc, types ...interface{})
+
+	// RegisterAlias makes `validate:"alias"` stand for tags.
+	RegisterAlias(alias, tags string)
+}
+
+// ErrorTranslator is implemented by validators whose errors can be
+// translated, see Validator.Translate.
+type ErrorTranslator interface {
+	Translate(err error, langs ...string) error
+}
+
+// RuleTranslator is implemented by validators that take messages for their
+// rules, see Validator.RegisterTranslation.
+type RuleTranslator interface {
+	RegisterTranslation(tag, lang, text string) error
+}
+
+// FieldNamer is implemented by validators that can name fields by the tag
+// of the binding, see FieldTag.
+type FieldNamer interface {
+	NamedBy(tag string) StructValidator
+}
+
+// ScenarioValidator is implemented by validators that support scenarios,
+// see Scenario.
+type ScenarioValidator interface {
+	ValidateScenario(obj any, scenario string) error
+}
+
+// BindOption changes how a bound value is validated.
+type BindOption func(*bindOptions)
+
+type bindOptions struct {
+	scenario string
+	tag      string
+}
+
+// Scenario validates with the rules of the named scenario: a field tagged
+// `validate_<name>` is checked by that tag instead of `validate`, e.g.
+//
+//	Name string `validate:"required" validate_update:"omitempty,min=3"`
+//
+// makes Name optional when binding with Scenario("update"). The elements
+// of a slice, array or map field are checked by their scenario tags only
+// when the field has one too, like `validate_update:"dive"`, otherwise by
+// their `validate` tags.
+func Scenario(name string) BindOption {
+	return func(o *bindOptions) {
+		o.scenario = name
+	}
+}
+
+// FieldTag names invalid fields by tag, the tag the binding read them by,
+// before their json or form name. Form and query bindings pass
+// FieldTag("form"), so a field tagged `json:"age" form:"years"` bound from a
+// form is reported as years.
+func FieldTag(tag string) BindOption {
+	return func(o *bindOptions) {
+		o.tag = tag
+	}
+}
+
+// Validate validates obj with v and translates the errors to the
+// Accept-Language of req, which may be nil. A nil v accepts everything.
+func Validate(v StructValidator, req *http.Request, obj any, opts ...BindOption) error {
+	if v == nil {
+		return nil
+	}
+	var o bindOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if n, ok := v.(FieldNamer); ok && o.tag != "" {
+		v = n.NamedBy(o.tag)
+	}
+
+	var err error
+	if o.scenario == "" {
+		err = v.ValidateStruct(obj)
+	} else if sv, ok := v.(ScenarioValidator); ok {
+		err = sv.ValidateScenario(obj, o.scenario)
+	} else {
+		return errors.Errorf("%T does not support scenarios", v)
+	}
+	if t, ok := v.(ErrorTranslator); ok && err != nil {
+		var langs []string
+		if req != nil {
+			langs = AcceptLanguages(req.Header.Get("Accept-Language"))
+		}
+		err = t.Translate(err, langs...)
+	}
+	return err
+}
+
+// Validator is the StructValidator built on go-playground/validator.
+type Validator struct {
+	*validator.Validate
+
+	uni     *ut.UniversalTranslator
+	nameTag string
+
+	mu          sync.Mutex
+	rules       []func(*Validator) // replayed on scenario and named validators
+	structRules []func(*Validator) // replayed on named validators
+	scenarios   map[string]*Validator
+	named       map[string]*Validator
+	excluded    sync.Map // scenarioKey: map[string]bool
+}
+
+type scenarioKey struct {
+	tp       reflect.Type
+	scenario string
+}
+
+// NewValidator returns a Validator that names fields by their json or form
+// tag and translates its errors to English and Chinese.
+func NewValidator() *Validator {
+	return newValidator("validate", "json")
+}
+
+// newValidator returns a Validator reading rules from ruleTag and naming
+// fields by nameTag, json or form.
+func newValidator(ruleTag, nameTag string) *Validator {
+	sv := &Validator{nameTag: nameTag}
+	v := validator.New()
+	v.SetTagName(ruleTag)
+	v.RegisterTagNameFunc(sv.fieldName)
+
+	english := en.New()
+	uni := ut.New(english, english, zh.New())
+	trans, _ := uni.GetTranslator("en")
+	en_translations.RegisterDefaultTranslations(v, trans)
+	trans.Add(_invalid, "{0} is invalid", false)
+	trans, _ = uni.GetTranslator("zh")
+	zh_translations.RegisterDefaultTranslations(v, trans)
+	trans.Add(_invalid, "{0}无效", false)
+
+	sv.Validate, sv.uni = v, uni
+	return sv
+}
+
+// _invalid is the message key of rules without a translation.
+const _invalid = "invalid"
+
+func (v *Validator) fieldName(fd reflect.StructField) string {
+	for _, tag := range []string{v.nameTag, "json", "form"} {
+		name, _ := parseTag(fd.Tag.Get(tag))
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return fd.Name
+}
+
+// RegisterValidation adds a rule for the validator and its scenarios.
+func (v *Validator) RegisterValidation(tag string, fn validator.Func, callValidationEvenIfNull ...bool) error {
+	if err := v.Validate.RegisterValidation(tag, fn, callValidationEvenIfNull...); err != nil {
+		return errors.WithStack(err)
+	}
+	v.replay(func(sv *Validator) {
+		sv.Validate.RegisterValidation(tag, fn, callValidationEvenIfNull...)
+	})
+	return nil
+}
+
+// RegisterTranslation sets the message of the rule tag in lang, en or zh.
+// {0} in text is the field name and {1} the rule param, e.g.
+//
+//	v.RegisterTranslation("sku", "en", "{0} must start with SKU-")
+//
+// Rules without a message in the language read "<field> is invalid".
+func (v *Validator) RegisterTranslation(tag, lang, text string) error {
+	if err := v.registerTranslation(tag, lang, text); err != nil {
+		return err
+	}
+	v.replay(func(sv *Validator) {
+		sv.registerTranslation(tag, lang, text)
+	})
+	return nil
+}
+
+func (v *Validator) registerTranslation(tag, lang, text string) error {
+	trans, ok := v.uni.GetTranslator(lang)
+	if !ok {
+		return errors.Errorf("no translator for language %s", lang)
+	}
+	err := v.Validate.RegisterTranslation(tag, trans, func(trans ut.Translator) error {
+		return trans.Add(tag, text, true)
+	}, func(trans ut.Translator, fe validator.FieldError) string {
+		msg, err := trans.T(tag, fe.Field(), fe.Param())
+		if err != nil {
+			return fe.Error()
+		}
+		return msg
+	})
+	return errors.WithStack(err)
+}
+
+// RegisterStructValidation adds a struct rule for the validator, scenarios
+// leave struct rules to the `validate` pass.
+func (v *Validator) RegisterStructValidation(fn validator.StructLevelFunc, types ...interface{}) {
+	v.Validate.RegisterStructValidation(fn, types...)
+	rule := func(nv *Validator) {
+		nv.Validate.RegisterStructValidation(fn, types...)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.structRules = append(v.structRules, rule)
+	for _, nv := range v.named {
+		rule(nv)
+	}
+}
+
+// RegisterAlias adds an alias for the validator and its scenarios.
+func (v *Validator) RegisterAlias(alias, tags string) {
+	v.Validate.RegisterAlias(alias, tags)
+	v.replay(func(sv *Validator) {
+		sv.Validate.RegisterAlias(alias, tags)
+	})
+}
+
+func (v *Validator) replay(rule func(*Validator)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rules = append(v.rules, rule)
+	for _, sv := range v.scenarios {
+		rule(sv)
+	}
+	for _, nv := range v.named {
+		rule(nv)
+		nv.replay(rule)
+	}
+}
+
+// NamedBy returns a validator with the rules of v that names fields by tag
+// before their json or form name. Rules are registered on v.
+func (v *Validator) NamedBy(tag string) StructValidator {
+	if tag == v.nameTag {
+		return v
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if nv, ok := v.named[tag]; ok {
+		return nv
+	}
+	nv := newValidator("validate", tag)
+	for _, rule := range v.rules {
+		rule(nv)
+		nv.rules = append(nv.rules, rule)
+	}
+	for _, rule := range v.structRules {
+		rule(nv)
+	}
+	if v.named == nil {
+		v.named = make(map[string]*Validator)
+	}
+	v.named[tag] = nv
+	return nv
+}
+
+func (v *Validator) ValidateStruct(obj any) error {
+	return v.validate(obj, "")
+}
+
+// ValidateScenario validates obj with the rules of scenario. Struct level
+// rules run once, with the fields checked by `validate`.
+func (v *Validator) ValidateScenario(obj any, scenario string) error {
+	return v.validate(obj, scenario)
+}
+
+func (v *Validator) validate(obj any, scenario string) error {
+	val := reflect.ValueOf(obj)
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+
+	errs := make(ElementErrors)
+	switch val.Kind() {
+	case reflect.Struct:
+		if scenario == "" {
+			return rooted(v.Struct(val.Interface()), val.Type())
+		}
+		return v.validateScenario(val, scenario)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			if err := v.validate(val.Index(i).Interface(), scenario); err != nil {
+				errs[fmt.Sprintf("[%d]", i)] = err
+			}
+		}
+	case reflect.Map:
+		iter := val.MapRange()
+		for iter.Next() {
+			if err := v.validate(iter.Value().Interface(), scenario); err != nil {
+				errs[fmt.Sprintf("[%v]", iter.Key())] = err
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateScenario checks the fields without a scenario tag with v and the
+// others with a validator reading the scenario tag.
+func (v *Validator) validateScenario(val reflect.Value, scenario string) error {
+	tp := val.Type()
+	excluded := v.excludedFields(tp, scenario)
+	err := rooted(v.StructFiltered(val.Interface(), func(ns []byte) bool {
+		return excluded[fieldPath(ns, tp.Name())]
+	}), tp)
+	if len(excluded) == 0 {
+		return err
+	}
+
+	sv := v.scenario(scenario)
+	serr := rooted(sv.Struct(val.Interface()), tp)
+	if err == nil && serr == nil {
+		return nil
+	}
+	return &scenarioError{base: err, scenario: serr, sv: sv}
+}
+
+func (v *Validator) scenario(name string) *Validator {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if sv, ok := v.scenarios[name]; ok {
+		return sv
+	}
+	sv := newValidator("validate_"+name, v.nameTag)
+	for _, rule := range v.rules {
+		rule(sv)
+	}
+	if v.scenarios == nil {
+		v.scenarios = make(map[string]*Validator)
+	}
+	v.scenarios[name] = sv
+	return sv
+}
+
+// excludedFields returns the paths, like Address.City, of the fields of tp
+// with a scenario tag. Fields in elements of slices and maps are included
+// only below a field with a scenario tag, the scenario validator does not
+// dive into the others.
+func (v *Validator) excludedFields(tp reflect.Type, scenario string) map[string]bool {
+	key := scenarioKey{tp, scenario}
+	if m, ok := v.excluded.Load(key); ok {
+		return m.(map[string]bool)
+	}
+	m := make(map[string]bool)
+	collectScenarioFields(tp, "validate_"+scenario, "", m, map[reflect.Type]bool{})
+	v.excluded.Store(key, m)
+	return m
+}
+
+func collectScenarioFields(tp reflect.Type, tag, prefix string, m map[string]bool, seen map[reflect.Type]bool) {
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	if tp.Kind() != reflect.Struct || seen[tp] {
+		return
+	}
+	seen[tp] = true
+	defer delete(seen, tp)
+
+	for i := 0; i < tp.NumField(); i++ {
+		fd := tp.Field(i)
+		if _, ok := fd.Tag.Lookup(tag); ok {
+			m[prefix+fd.Name] = true
+			continue
+		}
+		collectScenarioFields(fd.Type, tag, prefix+fd.Name+".", m, seen)
+	}
+}
+
+// fieldPath turns a validator namespace like User.Items[0].Name into the
+// path Items.Name, root is the name of the validated struct type.
+func fieldPath(ns []byte, root string) string {
+	if root != "" {
+		ns = bytes.TrimPrefix(ns, []byte(root+"."))
+	}
+	out := make([]byte, 0, len(ns))
+	depth := 0
+	for _, c := range ns {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
+// rootErrors are the validation errors of a struct of type root, their
+// namespaces start with the type name, which is empty for anonymous
+// structs.
+type rootErrors struct {
+	validator.ValidationErrors
+	root reflect.Type
+}
+
+func (e rootErrors) Unwrap() error {
+	return e.ValidationErrors
+}
+
+func rooted(err error, tp reflect.Type) error {
+	var ves validator.ValidationErrors
+	if !errors.As(err, &ves) {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(rootErrors{ves, tp})
+}
+
+// scenarioError holds the errors of both passes of a scenario, sv
+// translates the errors of the scenario pass.
+type scenarioError struct {
+	base, scenario error
+	sv             *Validator
+}
+
+func (e *scenarioError) Error() string {
+	switch {
+	case e.base == nil:
+		return e.scenario.Error()
+	case e.scenario == nil:
+		return e.base.Error()
+	}
+	return e.base.Error() + "\n" + e.scenario.Error()
+}
+
+// ElementErrors holds the errors of the elements of a slice, array or map,
+// keyed by [index] or [key].
+type ElementErrors map[string]error
+
+func (e ElementErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + ": " + e[k].Error()
+	}
+	return strings.Join(keys, "; ")
+}
+
+// Translate turns validation errors into Errors in the first of langs the
+// validator has translations for, other errors are returned as is. Errors
+// of elements are named like [0].name.
+func (v *Validator) Translate(err error, langs ...string) error {
+	if v.uni == nil {
+		return err
+	}
+	var se *scenarioError
+	if errors.As(err, &se) {
+		out := make(Errors)
+		for _, tr := range []error{v.Translate(se.base, langs...), se.sv.Translate(se.scenario, langs...)} {
+			var fes Errors
+			if errors.As(tr, &fes) {
+				for name, msg := range fes {
+					out[name] = msg
+				}
+			} else if tr != nil {
+				return tr
+			}
+		}
+		return out
+	}
+	var ees ElementErrors
+	if errors.As(err, &ees) {
+		out := make(Errors)
+		for k, err := range ees {
+			tr := v.Translate(err, langs...)
+			var fes Errors
+			if !errors.As(tr, &fes) {
+				out[k] = tr.Error()
+				continue
+			}
+			for name, msg := range fes {
+				out[k+"."+name] = msg
+			}
+		}
+		return out
+	}
+
+	var re rootErrors
+	if !errors.As(err, &re) {
+		var ves validator.ValidationErrors
+		if !errors.As(err, &ves) {
+			return err
+		}
+		re.ValidationErrors = ves
+	}
+	trans, _ := v.uni.FindTranslator(langs...)
+	out := make(Errors, len(re.ValidationErrors))
+	for _, fe := range re.ValidationErrors {
+		name := fe.Namespace()
+		if re.root != nil && re.root.Name() != "" {
+			name = strings.TrimPrefix(name, re.root.Name()+".")
+		}
+		out[name] = v.translateError(trans, fe, re.root)
+	}
+	return out
+}
+
+// translateError translates fe, naming the field a cross field rule like
+// eqfield=Password compares with as v names fields.
+func (v *Validator) translateError(trans ut.Translator, fe validator.FieldError, root reflect.Type) string {
+	if strings.Contains(fe.Tag(), "field") && fe.Param() != "" && root != nil {
+		if param, ok := v.paramName(root, fe.StructNamespace(), fe.Param()); ok {
+			if msg, err := trans.T(fe.Tag(), fe.Field(), param); err == nil {
+				return msg
+			}
+		}
+	}
+	if msg := fe.Translate(trans); msg != fe.Error() {
+		return msg
+	}
+	msg, err := trans.T(_invalid, fe.Field())
+	if err != nil {
+		return fe.Error()
+	}
+	return msg
+}
+
+// paramName looks up the field path param, relative to the struct holding
+// the field at ns or else to root, and returns its names joined by dots.
+func (v *Validator) paramName(root reflect.Type, ns, param string) (string, bool) {
+	path := strings.Split(ns, ".")
+	if len(path) > 1 && (root.Name() != "" || path[0] == "") {
+		path = path[1:]
+	}
+	parent, ok := walkFields(root, path[:len(path)-1])
+	if !ok {
+		return "", false
+	}
+	for _, tp := range []reflect.Type{parent, root} {
+		var names []string
+		if fieldsOf(tp, strings.Split(param, "."), func(fd reflect.StructField) {
+			names = append(names, v.fieldName(fd))
+		}) {
+			return strings.Join(names, "."), true
+		}
+	}
+	return "", false
+}
+
+func walkFields(tp reflect.Type, path []string) (reflect.Type, bool) {
+	ok := fieldsOf(tp, path, func(fd reflect.StructField) { tp = fd.Type })
+	return tp, ok
+}
+
+// fieldsOf calls fn with the fields of tp along path, whose elements may
+// end with an index like Items[0].
+func fieldsOf(tp reflect.Type, path []string, fn func(reflect.StructField)) bool {
+	for _, name := range path {
+		for tp.Kind() == reflect.Ptr || tp.Kind() == reflect.Slice || tp.Kind() == reflect.Array || tp.Kind() == reflect.Map {
+			tp = tp.Elem()
+		}
+		if i := strings.IndexByte(name, '['); i >= 0 {
+			name = name[:i]
+		}
+		if tp.Kind() != reflect.Struct {
+			return false
+		}
+		fd, ok := tp.FieldByName(name)
+		if !ok {
+			return false
+		}
+		fn(fd)
+		tp = fd.Type
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package binding
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+type testAccount struct {
+	Name     string `json:"name" validate:"required"`
+	Password string `json:"password" validate:"min=3"`
+	Confirm  string `json:"confirm" validate:"eqfield=Password"`
+}
+
+func TestValidatorCollections(t *testing.T) {
+	v := NewValidator()
+	assert.Nil(t, v.ValidateStruct(nil))
+	assert.Nil(t, v.ValidateStruct(3))
+	assert.Nil(t, v.ValidateStruct([]testAccount{{Name: "a", Password: "abc", Confirm: "abc"}}))
+
+	err := v.ValidateStruct(&[]*testAccount{
+		{Name: "a", Password: "abc", Confirm: "abc"},
+		{Password: "abc", Confirm: "abd"},
+	})
+	assert.Equal(t, v.Translate(err), Errors{
+		"[1].name":    "name is a required field",
+		"[1].confirm": "confirm must be equal to password",
+	})
+
+	err = v.ValidateStruct(map[string]testAccount{"bob": {Name: "bob", Password: "x", Confirm: "x"}})
+	assert.Equal(t, v.Translate(err), Errors{"[bob].password": "password must be at least 3 characters in length"})
+}
+
+func TestValidatorRules(t *testing.T) {
+	type signup struct {
+		Name  string `json:"name" validate:"lower"`
+		Email string `json:"email" validate:"contact"`
+		Phone string `json:"phone"`
+	}
+
+	v := NewValidator()
+	assert.Nil(t, v.RegisterValidation("lower", func(fl validator.FieldLevel) bool {
+		return strings.ToLower(fl.Field().String()) == fl.Field().String()
+	}))
+	v.RegisterAlias("contact", "omitempty,email")
+	v.RegisterStructValidation(func(sl validator.StructLevel) {
+		s := sl.Current().Interface().(signup)
+		if s.Email == "" && s.Phone == "" {
+			sl.ReportError(s.Email, "email", "Email", "required_without", "phone")
+		}
+	}, signup{})
+
+	assert.Nil(t, v.ValidateStruct(signup{Name: "bob", Phone: "123"}))
+	err := v.ValidateStruct(signup{Name: "Bob"})
+	fes := v.Translate(err).(Errors)
+	assert.Equal(t, len(fes), 2)
+	assert.Contains(t, fes, "name")
+	assert.Contains(t, fes, "email")
+	assert.Error(t, v.ValidateStruct(signup{Name: "bob", Email: "nope"}))
+
+	assert.Error(t, v.RegisterTranslation("lower", "fr", "{0}"))
+	assert.Nil(t, v.RegisterTranslation("lower", "en", "{0} must be lower case"))
+	assert.Equal(t, v.Translate(v.ValidateStruct(signup{Name: "Bob", Phone: "1"})), Errors{"name": "name must be lower case"})
+	assert.Equal(t, v.Translate(v.ValidateStruct(signup{Name: "Bob", Phone: "1"}), "zh"), Errors{"name": "name无效"})
+
+	// rules stay on the validator they were registered on
+	other := NewValidator()
+	assert.Panics(t, func() { other.ValidateStruct(signup{Name: "bob"}) })
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Validate(nil, nil, &testAccount{}))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "zh")
+	err := Validate(NewValidator(), req, &testAccount{Password: "abc", Confirm: "abc"})
+	assert.Equal(t, err, Errors{"name": "name为必填字段"})
+}
+
+func TestValidateFieldTag(t *testing.T) {
+	type person struct {
+		Name    string `json:"name" form:"full_name" validate:"required"`
+		Age     int    `json:"age" form:"years" validate:"gte=18" validate_update:"omitempty,gte=21"`
+		Confirm int    `json:"confirm" form:"again" validate:"eqfield=Age"`
+	}
+
+	v := NewValidator()
+	v.RegisterStructValidation(func(sl validator.StructLevel) {
+		if sl.Current().Interface().(person).Name == "root" {
+			sl.ReportError("", "name", "Name", "reserved", "")
+		}
+	}, person{})
+
+	err := Validate(v, nil, &person{Age: 3, Confirm: 4}, FieldTag("form"))
+	assert.Equal(t, err, Errors{
+		"full_name": "full_name is a required field",
+		"years":     "years must be 18 or greater",
+		"again":     "again must be equal to years",
+	})
+	err = Validate(v, nil, &person{Name: "a", Age: 3, Confirm: 3})
+	assert.Equal(t, err, Errors{"age": "age must be 18 or greater"})
+	err = Validate(v, nil, &person{Name: "a", Age: 20, Confirm: 20}, FieldTag("form"), Scenario("update"))
+	assert.Equal(t, err, Errors{"years": "years must be 21 or greater"})
+
+	// rules registered on v apply to its named validators
+	err = Validate(v, nil, &person{Name: "root", Age: 20, Confirm: 20}, FieldTag("form"))
+	assert.Equal(t, err, Errors{"name": "name is invalid"})
+	v.RegisterAlias("adult", "gte=18")
+	assert.NotPanics(t, func() {
+		Validate(v, nil, &struct {
+			Age int `form:"years" validate:"adult"`
+		}{}, FieldTag("form"))
+	})
+}
+
+type testProfile struct {
+	Name    string `json:"name" validate:"required" validate_update:"omitempty,min=3"`
+	Email   string `json:"email" validate:"required,email"`
+	Age     int    `json:"age" validate:"gte=18" validate_update:"omitempty,gte=18"`
+	Address struct {
+		City string `json:"city" validate:"required" validate_update:"omitempty,upper"`
+	} `json:"address"`
+	Tags []struct {
+		Value string `json:"value" validate:"required" validate_update:"max=3"`
+	} `json:"tags" validate:"dive" validate_update:"dive"`
+}
+
+func TestValidatorScenario(t *testing.T) {
+	v := NewValidator()
+	assert.Nil(t, v.RegisterValidation("upper", func(fl validator.FieldLevel) bool {
+		return strings.ToUpper(fl.Field().String()) == fl.Field().String()
+	}))
+
+	p := testProfile{Email: "a@b.c"}
+	assert.Equal(t, v.Translate(v.ValidateStruct(p)), Errors{
+		"name":         "name is a required field",
+		"age":          "age must be 18 or greater",
+		"address.city": "city is a required field",
+	})
+	assert.Nil(t, v.ValidateScenario(p, "update"))
+
+	p.Name, p.Address.City = "ab", "paris"
+	p.Tags = append(p.Tags, struct {
+		Value string `json:"value" validate:"required" validate_update:"max=3"`
+	}{"long"})
+	err := v.ValidateScenario(&p, "update")
+	assert.Equal(t, v.Translate(err), Errors{
+		"name":          "name must be at least 3 characters in length",
+		"address.city":  "city is invalid",
+		"tags[0].value": "value must be a maximum of 3 characters in length",
+	})
+	assert.Nil(t, v.RegisterTranslation("upper", "en", "{0} must be upper case"))
+	assert.Equal(t, v.Translate(v.ValidateScenario(&p, "update")).(Errors)["address.city"], "city must be upper case")
+
+	p.Email = ""
+	req, _ := http.NewRequest("PATCH", "/", nil)
+	req.Header.Set("Accept-Language", "zh")
+	err = Validate(v, req, []testProfile{p}, Scenario("update"))
+	fes := err.(Errors)
+	assert.Equal(t, fes["[0].email"], "email为必填字段")
+	assert.Equal(t, fes["[0].name"], "name长度必须至少为3个字符")
+	assert.Equal(t, len(fes), 4)
+
+	// elements of a slice without a scenario tag keep their validate rules
+	type order struct {
+		Items []struct {
+			SKU string `json:"sku" validate:"required" validate_update:"max=3"`
+		} `json:"items" validate:"dive"`
+	}
+	o := order{Items: []struct {
+		SKU string `json:"sku" validate:"required" validate_update:"max=3"`
+	}{{"long"}, {""}}}
+	assert.Equal(t, v.Translate(v.ValidateScenario(o, "update")), Errors{"items[1].sku": "sku is a required field"})
+}
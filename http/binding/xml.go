@@ -0,0 +1,53 @@
+package binding
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// defaultXMLBodyBytes limits XML bodies that have no limit set by
+// LimitBody.
+const defaultXMLBodyBytes = 10 << 20
+
+// ErrXMLDirective is returned for XML bodies with a DTD or any other
+// <!...> directive, entity declarations are not expanded.
+var ErrXMLDirective = errors.New("xml directives are not allowed")
+
+type xmlBinding struct{}
+
+func (xmlBinding) Name() string {
+	return "xml"
+}
+
+func (x xmlBinding) Bind(req *http.Request, obj interface{}) error {
+	if err := x.Decode(req, obj); err != nil {
+		return err
+	}
+	return validate(req, obj)
+}
+
+func (xmlBinding) Decode(req *http.Request, obj interface{}) error {
+	if _, ok := req.Body.(*limitedBody); !ok {
+		LimitBody(req, defaultXMLBodyBytes)
+	}
+	decoder := xml.NewTokenDecoder(noDirectives{xml.NewDecoder(req.Body)})
+	if err := decoder.Decode(obj); err != nil {
+		return bodyError(err)
+	}
+	return nil
+}
+
+// noDirectives passes the raw tokens of d on, failing on directives.
+type noDirectives struct {
+	d *xml.Decoder
+}
+
+func (r noDirectives) Token() (xml.Token, error) {
+	t, err := r.d.RawToken()
+	if _, ok := t.(xml.Directive); ok {
+		return nil, ErrXMLDirective
+	}
+	return t, err
+}
@@ -0,0 +1,28 @@
+package binding
+
+import (
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+)
+
+type yamlBinding struct{}
+
+func (yamlBinding) Name() string {
+	return "yaml"
+}
+
+func (y yamlBinding) Bind(req *http.Request, obj interface{}) error {
+	if err := y.Decode(req, obj); err != nil {
+		return err
+	}
+	return validate(req, obj)
+}
+
+func (yamlBinding) Decode(req *http.Request, obj interface{}) error {
+	decoder := yaml.NewDecoder(req.Body)
+	if err := decoder.Decode(obj); err != nil {
+		return bodyError(overflowError(req.Body, err))
+	}
+	return nil
+}
@@ -2,14 +2,17 @@ package http
 
 import (
 	"context"
+	"net"
 	"net/http"
-	"strconv"
+	"net/url"
 	"strings"
+	"sync"
 
 	"fbnoi.com/gonet/http/binding"
 	"fbnoi.com/gonet/http/render"
 	"fbnoi.com/httprouter"
 	"fbnoi.com/template"
+	"github.com/pkg/errors"
 )
 
 type Context struct {
@@ -18,47 +21,78 @@ type Context struct {
 	Request        *http.Request
 	ResponseWriter http.ResponseWriter
 	Engine         *Engine
-	RouteParams    httprouter.Params
+	RouteParams    Params
 
 	Error error
 
+	query url.Values
+
+	maxMemory  int64
+	formParsed bool
+	formErr    error
+
+	mu    sync.RWMutex
 	store map[string]any
+
+	deadline deadline
+}
+
+func (ctx *Context) reset(e *Engine, r *http.Request, w http.ResponseWriter, ps Params, conf *settings) {
+	ctx.Request = r
+	ctx.ResponseWriter = w
+	ctx.Engine = e
+	ctx.RouteParams = ps
+	ctx.Error = nil
+	ctx.query = nil
+	ctx.maxMemory = conf.MaxMemory
+	ctx.formParsed, ctx.formErr = false, nil
+	ctx.deadline.reset(conf.TimeOut)
+	ctx.Context = &ctx.deadline
 }
 
 func (ctx *Context) HTML(path string, ps template.Params, code int) {
-	writeStatus(ctx.ResponseWriter, code)
 	h := render.HTML{ViewPath: path, Params: ps}
-	ctx.Error = h.Render(ctx.ResponseWriter)
+	if ctx.Engine != nil {
+		h.Renderer = ctx.Engine.renderer
+	}
+	ctx.Render(code, h)
 }
 
 func (ctx *Context) JSON(j *render.JSON, code int) {
-	writeStatus(ctx.ResponseWriter, code)
-	ctx.Error = j.Render(ctx.ResponseWriter)
+	ctx.Render(code, j)
 }
 
 func (ctx *Context) XML(d any, code int) {
-	writeStatus(ctx.ResponseWriter, code)
-	x := render.XML{Data: d}
-	ctx.Error = x.Render(ctx.ResponseWriter)
+	ctx.Render(code, render.XML{Data: d})
+}
+
+func (ctx *Context) YAML(d any, code int) {
+	ctx.Render(code, render.YAML{Data: d})
 }
 
 func (ctx *Context) String(code int, format string, values ...any) {
-	writeStatus(ctx.ResponseWriter, code)
-	s := render.String{Format: format, Data: values}
-	ctx.Error = s.Render(ctx.ResponseWriter)
+	ctx.Render(code, render.String{Format: format, Data: values})
 }
 
 func (ctx *Context) Bytes(code int, contentType string, data ...[]byte) {
-	writeStatus(ctx.ResponseWriter, code)
-	d := render.Data{
+	ctx.Render(code, render.Data{
 		ContentType: contentType,
 		Data:        data,
+	})
+}
+
+// Render writes the status and r, the Content-Type of r is set before the
+// status since headers set after it are not sent.
+func (ctx *Context) Render(code int, r render.Render) {
+	if c, ok := r.(render.ContentTyper); ok {
+		c.WriteContentType(ctx.ResponseWriter)
 	}
-	ctx.Error = d.Render(ctx.ResponseWriter)
+	writeStatus(ctx.ResponseWriter, code)
+	ctx.Error = r.Render(ctx.ResponseWriter)
 }
 
+// Redirect leaves the status to http.Redirect, which sets Location first.
 func (ctx *Context) Redirect(code int, location string) {
-	writeStatus(ctx.ResponseWriter, code)
 	r := render.Redirect{
 		Code:     code,
 		Location: location,
@@ -68,86 +102,462 @@ func (ctx *Context) Redirect(code int, location string) {
 }
 
 func (ctx *Context) RedirectToRoute(code int, name string, ps httprouter.Params) {
-	url := ctx.Engine.router.GeneratePath(name, ps)
+	url := ctx.Engine.tree().GeneratePath(name, ps)
 	ctx.Redirect(code, url)
 }
 
+// ClientIP returns the IP address of the client, or nil if it cannot be
+// determined. When the request comes from a trusted proxy, the address is
+// taken from X-Forwarded-For, skipping trusted hops from the right, or from
+// X-Real-IP.
+func (ctx *Context) ClientIP() net.IP {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(ctx.Request.RemoteAddr))
+	if err != nil {
+		host = ctx.Request.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ctx.Engine == nil || !containsIP(ctx.Engine.trustedProxies, ip) {
+		return ip
+	}
+
+	if xff := ctx.Request.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				break
+			}
+			ip = hop
+			if !containsIP(ctx.Engine.trustedProxies, hop) {
+				return hop
+			}
+		}
+		return ip
+	}
+	if real := net.ParseIP(strings.TrimSpace(ctx.Request.Header.Get("X-Real-IP"))); real != nil {
+		return real
+	}
+
+	return ip
+}
+
+func (ctx *Context) Param(name string) string {
+	return ctx.RouteParams.ByName(name)
+}
+
+func (ctx *Context) ParamInt(name string) (int, error) {
+	return Param[int](ctx, name)
+}
+
+func (ctx *Context) ParamInt64(name string) (int64, error) {
+	return Param[int64](ctx, name)
+}
+
+func (ctx *Context) ParamUUID(name string) (string, error) {
+	s := ctx.Param(name)
+	if s == "" {
+		return "", &ParamError{Source: "path", Name: name, Err: errMissingValue}
+	}
+	id, err := parseUUID(s)
+	if err != nil {
+		return "", &ParamError{Source: "path", Name: name, Value: s, Err: err}
+	}
+
+	return id, nil
+}
+
+// Param converts the route parameter name to T. A missing or malformed
+// value yields a *ParamError.
+func Param[T any](ctx *Context, name string) (T, error) {
+	var vs []string
+	if s := ctx.Param(name); s != "" {
+		vs = []string{s}
+	}
+
+	return convert[T]("path", name, vs)
+}
+
+// ParseForm parses the query and the request body as a form, a multipart
+// body keeps up to the route MaxMemory in memory. The body is parsed once,
+// later calls return the first result. Post and the Post* accessors call it
+// on first use.
+func (ctx *Context) ParseForm() error {
+	if ctx.formParsed {
+		return ctx.formErr
+	}
+	ctx.formParsed = true
+
+	var err error
+	if strings.Contains(ctx.Request.Header.Get("Content-Type"), binding.MIME_MultipartPOSTForm) {
+		err = ctx.Request.ParseMultipartForm(ctx.maxMemory)
+	} else {
+		err = ctx.Request.ParseForm()
+	}
+	if err != nil {
+		ctx.formErr = formError(err)
+	}
+
+	return ctx.formErr
+}
+
+func formError(err error) error {
+	var tooLarge *binding.BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		return tooLarge
+	}
+
+	return &ParamError{Source: "form", Err: err}
+}
+
+// Post returns the first posted value for name, or "" when the body cannot
+// be parsed; call ParseForm to get the error.
 func (ctx *Context) Post(name string) string {
-	return ctx.Request.PostForm.Get(name)
+	return first(ctx.postValues()[name])
 }
 
+// PostInt, PostBool and PostFloat fail when the value is missing or empty,
+// use Form for a default.
 func (ctx *Context) PostInt(name string) (int, error) {
-	i := ctx.Post(name)
-
-	return strconv.Atoi(i)
+	return postValue[int](ctx, name)
 }
 
 func (ctx *Context) PostBool(name string) (bool, error) {
-	i := ctx.Post(name)
-
-	return strconv.ParseBool(i)
+	return postValue[bool](ctx, name)
 }
 
 func (ctx *Context) PostFloat(name string) (float64, error) {
-	i := ctx.Post(name)
+	return postValue[float64](ctx, name)
+}
 
-	return strconv.ParseFloat(i, 64)
+func postValue[T any](ctx *Context, name string) (v T, err error) {
+	if err = ctx.ParseForm(); err != nil {
+		return
+	}
+
+	return required[T](ctx.postValues(), "form", name)
 }
 
+// PostSlice returns every value posted for name, each split by sep.
 func (ctx *Context) PostSlice(name, sep string) []string {
-	i := ctx.Post(name)
-
-	return strings.Split(i, sep)
+	return splitAll(ctx.postValues()[name], sep)
 }
 
 func (ctx *Context) GetQuery(name string) string {
-	return ctx.Request.URL.Query().Get(name)
+	return first(ctx.queryValues()[name])
 }
 
+// GetInt, GetBool and GetFloat fail when the value is missing or empty, use
+// Query for a default.
 func (ctx *Context) GetInt(name string) (int, error) {
-	i := ctx.GetQuery(name)
-
-	return strconv.Atoi(i)
+	return required[int](ctx.queryValues(), "query", name)
 }
 
 func (ctx *Context) GetBool(name string) (bool, error) {
-	i := ctx.GetQuery(name)
-
-	return strconv.ParseBool(i)
+	return required[bool](ctx.queryValues(), "query", name)
 }
 
 func (ctx *Context) GetFloat(name string) (float64, error) {
-	i := ctx.GetQuery(name)
-
-	return strconv.ParseFloat(i, 64)
+	return required[float64](ctx.queryValues(), "query", name)
 }
 
+// GetSlice returns every value of the query key name, each split by sep.
 func (ctx *Context) GetSlice(name, sep string) []string {
-	i := ctx.GetQuery(name)
+	return splitAll(ctx.queryValues()[name], sep)
+}
+
+// Query converts the query value name to T, or returns def when it is
+// absent or empty. A slice T collects repeated keys, e.g. ?id=1&id=2.
+func Query[T any](ctx *Context, name string, def T) (T, error) {
+	return lookup(ctx.queryValues(), "query", name, def)
+}
 
-	return strings.Split(i, sep)
+// Form is like Query but reads the posted form values. It fails when the
+// body cannot be parsed.
+func Form[T any](ctx *Context, name string, def T) (T, error) {
+	if err := ctx.ParseForm(); err != nil {
+		return def, err
+	}
+
+	return lookup(ctx.postValues(), "form", name, def)
 }
 
-func (ctx *Context) Bind(obj any) error {
+// required converts the first value of name, like the path params a
+// missing or empty value is an error.
+func required[T any](values url.Values, source, name string) (T, error) {
+	var vs []string
+	if s := first(values[name]); s != "" {
+		vs = []string{s}
+	}
+
+	return convert[T](source, name, vs)
+}
+
+func lookup[T any](values url.Values, source, name string, def T) (T, error) {
+	vs := values[name]
+	if len(vs) == 0 || len(vs) == 1 && vs[0] == "" {
+		return def, nil
+	}
+
+	return convert[T](source, name, vs)
+}
+
+func (ctx *Context) queryValues() url.Values {
+	if ctx.query == nil {
+		ctx.query = ctx.Request.URL.Query()
+	}
+
+	return ctx.query
+}
+
+func (ctx *Context) postValues() url.Values {
+	ctx.ParseForm()
+
+	return ctx.Request.PostForm
+}
+
+func first(vs []string) string {
+	if len(vs) == 0 {
+		return ""
+	}
+
+	return vs[0]
+}
+
+func splitAll(vs []string, sep string) []string {
+	var out []string
+	for _, v := range vs {
+		out = append(out, strings.Split(v, sep)...)
+	}
+
+	return out
+}
+
+func (ctx *Context) Bind(obj any, opts ...binding.BindOption) error {
 	b := binding.Default(ctx.Request.Method, ctx.Request.Header.Get("Content-Type"))
 
-	return ctx.BindWith(obj, b)
+	return ctx.BindWith(obj, b, opts...)
+}
+
+// BindWith decodes the request into obj with b and validates it with the
+// engine validator, opts like binding.Scenario select the rules. Bindings
+// that are not a binding.Decoder validate by themselves and take no opts.
+// Invalid fields are named by the tag b reads, see binding.FieldTag.
+func (ctx *Context) BindWith(obj any, b binding.BindingInterface, opts ...binding.BindOption) error {
+	switch b {
+	case binding.Form, binding.FormPost, binding.FormMultipart:
+		if err := ctx.ParseForm(); err != nil {
+			return err
+		}
+		fallthrough
+	case binding.Query:
+		opts = withFieldTag("form", opts)
+	case binding.Header:
+		opts = withFieldTag("header", opts)
+	case binding.Cookie:
+		opts = withFieldTag("cookie", opts)
+	}
+	if vd, ok := b.(binding.ValidatingDecoder); ok {
+		return vd.DecodeValidate(ctx.Request, obj, func(v any) error {
+			return ctx.Engine.validate(ctx.Request, v, opts...)
+		})
+	}
+	d, ok := b.(binding.Decoder)
+	if !ok {
+		if len(opts) > 0 {
+			return errors.Errorf("binding %s does not take bind options", b.Name())
+		}
+		return b.Bind(ctx.Request, obj)
+	}
+	if err := d.Decode(ctx.Request, obj); err != nil {
+		return err
+	}
+
+	return ctx.Engine.validate(ctx.Request, obj, opts...)
+}
+
+// BindUri fills the fields of obj tagged `uri` from the route params and
+// validates it.
+func (ctx *Context) BindUri(obj any, opts ...binding.BindOption) error {
+	if err := binding.Uri.DecodeUri(ctx.RouteParams, obj); err != nil {
+		return err
+	}
+
+	return ctx.Engine.validate(ctx.Request, obj, withFieldTag("uri", opts)...)
+}
+
+// BindAll fills obj from the query, the headers, the body and the route
+// params, in that order, so a later source wins over an earlier one. The
+// body is decoded by the binding for its Content-Type, a plain form body as
+// FormPost so that query values are not read twice. obj is validated once
+// at the end, naming invalid fields by their form tag unless the body is
+// not a form.
+func (ctx *Context) BindAll(obj any, opts ...binding.BindOption) error {
+	if err := binding.Query.Decode(ctx.Request, obj); err != nil {
+		return err
+	}
+	if err := binding.Header.Decode(ctx.Request, obj); err != nil {
+		return err
+	}
+	tag := "form"
+	if hasBody(ctx.Request) {
+		b := binding.Default(ctx.Request.Method, ctx.Request.Header.Get("Content-Type"))
+		switch b {
+		case binding.Form:
+			b = binding.FormPost
+			fallthrough
+		case binding.FormPost, binding.FormMultipart:
+			if err := ctx.ParseForm(); err != nil {
+				return err
+			}
+		default:
+			tag = ""
+		}
+		if d, ok := b.(binding.Decoder); ok {
+			if err := d.Decode(ctx.Request, obj); err != nil {
+				return err
+			}
+		}
+	}
+	if err := binding.Uri.DecodeUri(ctx.RouteParams, obj); err != nil {
+		return err
+	}
+	if tag != "" {
+		opts = withFieldTag(tag, opts)
+	}
+
+	return ctx.Engine.validate(ctx.Request, obj, opts...)
+}
+
+// withFieldTag puts binding.FieldTag(tag) before opts, so that a FieldTag
+// of the caller wins.
+func withFieldTag(tag string, opts []binding.BindOption) []binding.BindOption {
+	return append([]binding.BindOption{binding.FieldTag(tag)}, opts...)
 }
 
-func (ctx *Context) BindWith(obj any, b binding.BindingInterface) error {
-	return b.Bind(ctx.Request, obj)
+func hasBody(r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return false
+	}
+
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
 }
 
+// Fail answers the request through the engine error handler and records
+// err in ctx.Error.
+func (ctx *Context) Fail(err error) {
+	h := defaultErrorHandler
+	if ctx.Engine != nil && ctx.Engine.errorHandler != nil {
+		h = ctx.Engine.errorHandler
+	}
+	h(ctx, err)
+	ctx.Error = err
+}
+
+// Set stores value under key. It is safe for concurrent use, and the value
+// is also visible through ctx.Value(key).
 func (ctx *Context) Set(key string, value any) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.store == nil {
+		ctx.store = make(map[string]any)
+	}
 	ctx.store[key] = value
 }
 
 func (ctx *Context) Get(key string) (val any, ok bool) {
+	ctx.mu.RLock()
+	defer ctx.mu.RUnlock()
 	val, ok = ctx.store[key]
 
 	return
 }
 
+// MustGet returns the value for key and panics if it does not exist.
+func (ctx *Context) MustGet(key string) any {
+	if val, ok := ctx.Get(key); ok {
+		return val
+	}
+	panic("key \"" + key + "\" does not exist")
+}
+
+// Value looks key up in the store first, then in the embedded context.
+func (ctx *Context) Value(key any) any {
+	if k, ok := key.(string); ok {
+		if val, ok := ctx.Get(k); ok {
+			return val
+		}
+	}
+	if ctx.Context == nil {
+		return nil
+	}
+
+	return ctx.Context.Value(key)
+}
+
+// Value returns the stored value for key as T. ok is false when the key
+// does not exist or holds a value of another type.
+func Value[T any](ctx *Context, key string) (val T, ok bool) {
+	v, exists := ctx.Get(key)
+	if !exists {
+		return
+	}
+	val, ok = v.(T)
+
+	return
+}
+
+// ErrDetachedWriter is returned when a copied Context tries to write a
+// response.
+var ErrDetachedWriter = errors.New("response writer is not available on a copied context")
+
+// Copy returns a snapshot of ctx that may be used after the handler returns,
+// e.g. by a goroutine. The copy has its own cancellable context, a clone of
+// the request without its body, the route params and a copy of the store.
+// Responses written through the copy fail with ErrDetachedWriter.
+func (ctx *Context) Copy() (*Context, context.CancelFunc) {
+	return ctx.copyWith(context.Background())
+}
+
+func (ctx *Context) copyWith(parent context.Context) (*Context, context.CancelFunc) {
+	c, cancel := context.WithCancel(parent)
+	r := ctx.Request.Clone(c)
+	r.Body = http.NoBody
+	cp := &Context{
+		Context:        c,
+		Request:        r,
+		ResponseWriter: detachedWriter{header: make(http.Header)},
+		Engine:         ctx.Engine,
+		RouteParams:    ctx.RouteParams,
+		formParsed:     ctx.formParsed,
+		formErr:        ctx.formErr,
+	}
+
+	ctx.mu.RLock()
+	defer ctx.mu.RUnlock()
+	if ctx.store != nil {
+		cp.store = make(map[string]any, len(ctx.store))
+		for k, v := range ctx.store {
+			cp.store[k] = v
+		}
+	}
+
+	return cp, cancel
+}
+
+type detachedWriter struct {
+	header http.Header
+}
+
+func (w detachedWriter) Header() http.Header {
+	return w.header
+}
+
+func (detachedWriter) Write([]byte) (int, error) {
+	return 0, ErrDetachedWriter
+}
+
+func (detachedWriter) WriteHeader(int) {}
+
 func writeStatus(w http.ResponseWriter, code int) {
 	w.WriteHeader(code)
 }
@@ -0,0 +1,444 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fbnoi.com/gonet/http/binding"
+	"fbnoi.com/gonet/http/render"
+	"fbnoi.com/httprouter"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextParam(t *testing.T) {
+	e := DefaultEngine()
+	e.GET("user", "/users/:id/:uuid", func(ctx *Context) {
+		id, err := ctx.ParamInt("id")
+		assert.Nil(t, err)
+		assert.Equal(t, id, 42)
+
+		uuid, err := ctx.ParamUUID("uuid")
+		assert.Nil(t, err)
+		assert.Equal(t, uuid, "6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+		_, err = Param[uint8](ctx, "missing")
+		var pe *ParamError
+		assert.True(t, errors.As(err, &pe))
+		assert.Equal(t, pe.StatusCode(), http.StatusBadRequest)
+	})
+	e.GET("bad", "/bad/:id", func(ctx *Context) {
+		_, err := ctx.ParamInt64("id")
+		assert.Error(t, err)
+		_, err = ctx.ParamUUID("id")
+		assert.Error(t, err)
+	})
+
+	serve(e, "GET", "/users/42/6BA7B810-9DAD-11D1-80B4-00C04FD430C8", "", "")
+	serve(e, "GET", "/bad/x1", "", "")
+}
+
+func TestContextQueryAndForm(t *testing.T) {
+	e := DefaultEngine()
+	e.POST("search", "/search", func(ctx *Context) {
+		ids, err := Query[[]int](ctx, "id", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, ids, []int{1, 2})
+
+		d, err := Query(ctx, "wait", time.Second)
+		assert.Nil(t, err)
+		assert.Equal(t, d, 1500*time.Millisecond)
+
+		since, err := Query(ctx, "since", time.Time{})
+		assert.Nil(t, err)
+		assert.Equal(t, since.Year(), 2022)
+
+		limit, err := Query(ctx, "limit", 20)
+		assert.Nil(t, err)
+		assert.Equal(t, limit, 20)
+
+		_, err = ctx.GetBool("tag")
+		assert.Error(t, err)
+		_, err = ctx.GetInt("limit")
+		assert.True(t, errors.Is(err, errMissingValue))
+		_, err = ctx.PostBool("missing")
+		assert.True(t, errors.Is(err, errMissingValue))
+		assert.Equal(t, ctx.GetSlice("tag", ","), []string{"a", "b", "c"})
+
+		f, err := ctx.PostFloat("price")
+		assert.Nil(t, err)
+		assert.Equal(t, f, 9.5)
+		ok, err := Form(ctx, "ok", false)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	})
+
+	serve(e, "POST", "/search?id=1&id=2&wait=1.5s&since=2022-08-01&tag=a,b&tag=c", binding.MIME_POSTForm, "price=9.5&ok=true")
+}
+
+func TestContextStore(t *testing.T) {
+	ctx := &Context{Context: context.Background()}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx.Set(fmt.Sprint(i), i)
+		}(i)
+	}
+	wg.Wait()
+
+	i, ok := Value[int](ctx, "3")
+	assert.True(t, ok)
+	assert.Equal(t, i, 3)
+	_, ok = Value[string](ctx, "3")
+	assert.False(t, ok)
+	assert.Equal(t, ctx.MustGet("9"), 9)
+	assert.Panics(t, func() { ctx.MustGet("missing") })
+
+	var c context.Context = ctx
+	assert.Equal(t, c.Value("5"), 5)
+	assert.Nil(t, c.Value("missing"))
+}
+
+func TestContextCopy(t *testing.T) {
+	e := DefaultEngine()
+	var cp *Context
+	var cancel context.CancelFunc
+	e.GET("copy", "/copy/:id", func(ctx *Context) {
+		ctx.Set("user", "tom")
+		cp, cancel = ctx.Copy()
+		ctx.Set("user", "jerry")
+		ctx.String(http.StatusOK, "done")
+	})
+	w := serve(e, "GET", "/copy/7?q=1", "", "")
+
+	assert.Equal(t, cp.Param("id"), "7")
+	assert.Equal(t, cp.GetQuery("q"), "1")
+	assert.Equal(t, cp.MustGet("user"), "tom")
+	cp.String(http.StatusOK, "late")
+	assert.True(t, errors.Is(cp.Error, ErrDetachedWriter))
+	assert.Equal(t, w.Body.String(), "done")
+
+	assert.Nil(t, cp.Err())
+	cancel()
+	assert.Equal(t, cp.Err(), context.Canceled)
+}
+
+func TestContextLazyForm(t *testing.T) {
+	e := DefaultEngine()
+	e.POST("auth", "/auth", func(ctx *Context) {
+		assert.False(t, ctx.formParsed)
+		ctx.String(http.StatusOK, "%s", ctx.GetQuery("token"))
+	})
+	e.POST("form", "/form", func(ctx *Context) {
+		assert.Equal(t, ctx.Post("name"), "")
+		_, err := ctx.PostInt("age")
+		var pe *ParamError
+		assert.True(t, errors.As(err, &pe))
+		assert.Equal(t, ctx.ParseForm(), err)
+	})
+
+	w := serve(e, "POST", "/auth?token=t", binding.MIME_POSTForm, "%zz")
+	assert.Equal(t, w.Body.String(), "t")
+	serve(e, "POST", "/form", binding.MIME_POSTForm, "name=%zz")
+}
+
+func TestContextDeadline(t *testing.T) {
+	e := DefaultEngine()
+	assert.Nil(t, e.SetConfig(&Config{TimeOut: 10 * time.Millisecond}))
+	e.GET("slow", "/slow", func(ctx *Context) {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.Nil(t, ctx.Err())
+		time.Sleep(15 * time.Millisecond)
+		assert.Equal(t, ctx.Err(), context.DeadlineExceeded)
+		<-ctx.Done()
+	})
+	canceled := make(chan struct{})
+	e.GET("fast", "/fast", func(ctx *Context) {
+		done := ctx.Done()
+		go func() {
+			<-done
+			close(canceled)
+		}()
+	})
+
+	serve(e, "GET", "/slow", "", "")
+	serve(e, "GET", "/fast", "", "")
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("context not canceled after the request")
+	}
+}
+
+func TestContextRelease(t *testing.T) {
+	e := DefaultEngine()
+	ctx := new(Context)
+	r := httptest.NewRequest("GET", "/", nil)
+	ctx.reset(e, r, httptest.NewRecorder(), httprouter.Params{}, e.routeConfig(""))
+	ctx.Set("k", "v")
+	ctx.Error = errors.New("failed")
+	done := ctx.Done()
+
+	e.release(ctx)
+	<-done
+	assert.Nil(t, ctx.Request)
+	assert.Nil(t, ctx.ResponseWriter)
+	assert.Nil(t, ctx.Engine)
+	assert.Equal(t, ctx.RouteParams, httprouter.Params{})
+	assert.Nil(t, ctx.Error)
+	assert.Empty(t, ctx.store)
+}
+
+func serve(e *Engine, method, url, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestContextRender(t *testing.T) {
+	e := DefaultEngine()
+	e.GET("json", "/json", func(ctx *Context) { ctx.JSON(&render.JSON{"ok": true}, http.StatusCreated) })
+	e.GET("xml", "/xml", func(ctx *Context) { ctx.XML(struct{ OK bool }{true}, http.StatusOK) })
+	e.GET("yaml", "/yaml", func(ctx *Context) { ctx.YAML(map[string]int{"count": 2}, http.StatusCreated) })
+	e.GET("string", "/string", func(ctx *Context) { ctx.String(http.StatusAccepted, "ok") })
+	e.GET("redirect", "/redirect", func(ctx *Context) { ctx.Redirect(http.StatusFound, "/json") })
+
+	for path, contentType := range map[string]string{
+		"/json":   "application/json; charset=utf-8",
+		"/xml":    "application/xml; charset=utf-8",
+		"/yaml":   "application/yaml; charset=utf-8",
+		"/string": "text/plain; charset=utf-8",
+	} {
+		res := serve(e, "GET", path, "", "").Result()
+		assert.Equal(t, res.Header.Get("Content-Type"), contentType, path)
+	}
+	w := serve(e, "GET", "/yaml", "", "")
+	assert.Equal(t, w.Code, http.StatusCreated)
+	assert.Equal(t, w.Body.String(), "count: 2\n")
+
+	res := serve(e, "GET", "/redirect", "", "").Result()
+	assert.Equal(t, res.StatusCode, http.StatusFound)
+	assert.Equal(t, res.Header.Get("Location"), "/json")
+}
+
+func TestContextMaxBodyBytes(t *testing.T) {
+	e := DefaultEngine()
+	var bindErr error
+	e.POST("json", "/json", func(ctx *Context) {
+		var obj struct {
+			Name string `json:"name"`
+		}
+		if bindErr = ctx.Bind(&obj); bindErr != nil {
+			ctx.Fail(bindErr)
+		}
+	})
+	e.POST("form", "/form", func(ctx *Context) {
+		if _, err := ctx.PostInt("age"); err != nil {
+			ctx.Fail(err)
+		}
+	})
+	assert.Error(t, e.SetRouteConfig("json", &Config{MaxBodyBytes: -1}))
+	assert.Nil(t, e.SetRouteConfig("json", &Config{MaxBodyBytes: 16}))
+	assert.Nil(t, e.SetRouteConfig("form", &Config{MaxBodyBytes: 16}))
+
+	w := serve(e, "POST", "/json", binding.MIME_JSON, `{"name":"gopher"}`)
+	assert.Equal(t, w.Code, http.StatusRequestEntityTooLarge)
+	var tooLarge *binding.BodyTooLargeError
+	assert.True(t, errors.As(bindErr, &tooLarge))
+
+	serve(e, "POST", "/json", binding.MIME_JSON, `{"name":"go"}`)
+	assert.Nil(t, bindErr)
+
+	w = serve(e, "POST", "/form", binding.MIME_POSTForm, "name=gopher&age=13")
+	assert.Equal(t, w.Code, http.StatusRequestEntityTooLarge)
+	assert.Equal(t, serve(e, "POST", "/form", binding.MIME_POSTForm, "age=13").Code, http.StatusOK)
+}
+
+func TestContextBindDecodeError(t *testing.T) {
+	e := DefaultEngine()
+	var bindErr error
+	e.POST("user", "/user", func(ctx *Context) {
+		var obj struct {
+			Name string `json:"name" form:"name"`
+			Age  int    `json:"age" form:"age"`
+		}
+		if bindErr = ctx.Bind(&obj); bindErr != nil {
+			ctx.Fail(bindErr)
+		}
+	})
+
+	var de *binding.DecodeError
+	assert.Equal(t, serve(e, "POST", "/user", binding.MIME_JSON, `{"name":`).Code, http.StatusBadRequest)
+	assert.True(t, errors.As(bindErr, &de))
+	assert.Equal(t, serve(e, "POST", "/user", binding.MIME_JSON, `{"age":"x"}`).Code, http.StatusBadRequest)
+	assert.Equal(t, serve(e, "POST", "/user", binding.MIME_POSTForm, "age=abc").Code, http.StatusBadRequest)
+	assert.True(t, errors.As(bindErr, &de))
+	assert.Equal(t, serve(e, "POST", "/user", binding.MIME_POSTForm, "age=7").Code, http.StatusOK)
+}
+
+func TestContextBindFieldTag(t *testing.T) {
+	e := DefaultEngine()
+	var bindErr error
+	e.POST("user", "/user", func(ctx *Context) {
+		var obj struct {
+			Age int `json:"age" form:"years" validate:"gte=18"`
+		}
+		bindErr = ctx.Bind(&obj)
+	})
+
+	serve(e, "POST", "/user", binding.MIME_POSTForm, "years=7")
+	assert.Equal(t, bindErr, binding.Errors{"years": "years must be 18 or greater"})
+	serve(e, "POST", "/user", binding.MIME_JSON, `{"age":7}`)
+	assert.Equal(t, bindErr, binding.Errors{"age": "age must be 18 or greater"})
+}
+
+func TestContextBindAll(t *testing.T) {
+	type order struct {
+		ID    int    `uri:"id" form:"id" validate:"required"`
+		Page  int    `form:"page" default:"1"`
+		Token string `header:"x-token" validate:"required"`
+		Name  string `form:"name" json:"name"`
+	}
+
+	e := DefaultEngine()
+	var got order
+	var bindErr error
+	e.POST("order", "/orders/:id", func(ctx *Context) {
+		got = order{}
+		bindErr = ctx.BindAll(&got)
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/orders/9?id=1&page=3&name=query", bytes.NewBufferString(`{"name":"body"}`))
+	r.Header.Set("Content-Type", binding.MIME_JSON)
+	r.Header.Set("X-Token", "t")
+	e.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Nil(t, bindErr)
+	assert.Equal(t, got, order{ID: 9, Page: 3, Token: "t", Name: "body"})
+
+	serve(e, http.MethodPost, "/orders/9", binding.MIME_POSTForm, "name=form")
+	assert.NotNil(t, bindErr)
+	assert.Equal(t, got, order{ID: 9, Page: 1, Name: "form"})
+}
+
+func TestContextValidationErrors(t *testing.T) {
+	e := DefaultEngine()
+	e.POST("user", "/user", func(ctx *Context) {
+		var obj struct {
+			Name string `form:"name" validate:"required"`
+		}
+		if err := ctx.Bind(&obj); err != nil {
+			ctx.Fail(err)
+		}
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/user", bytes.NewBufferString("name="))
+	r.Header.Set("Content-Type", binding.MIME_POSTForm)
+	r.Header.Set("Accept-Language", "zh")
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusUnprocessableEntity)
+	assert.Equal(t, w.Result().Header.Get("Content-Type"), "application/json; charset=utf-8")
+	assert.Equal(t, w.Body.String(), `{"errors":{"name":"name为必填字段"}}`+"\n")
+}
+
+func TestContextEngineValidator(t *testing.T) {
+	type item struct {
+		SKU string `json:"sku" validate:"sku"`
+	}
+	strict, lax := DefaultEngine(), DefaultEngine()
+	strict.Validator().RegisterValidation("sku", func(fl validator.FieldLevel) bool {
+		return strings.HasPrefix(fl.Field().String(), "SKU-")
+	})
+	lax.Validator().RegisterValidation("sku", func(fl validator.FieldLevel) bool { return true })
+
+	var errs []error
+	for _, e := range []*Engine{strict, lax} {
+		e.POST("items", "/items", func(ctx *Context) {
+			var items []item
+			errs = append(errs, ctx.Bind(&items))
+		})
+		serve(e, http.MethodPost, "/items", binding.MIME_JSON, `[{"sku":"SKU-1"},{"sku":"2"}]`)
+	}
+	assert.Equal(t, errs[0], binding.Errors{"[1].sku": "sku is invalid"})
+	assert.Nil(t, errs[1])
+}
+
+func TestContextBindScenario(t *testing.T) {
+	type profile struct {
+		Name  string `json:"name" validate:"required" validate_update:"omitempty,min=3"`
+		Email string `json:"email" validate:"required,email" validate_update:"omitempty,email"`
+	}
+
+	e := DefaultEngine()
+	var bindErr error
+	e.POST("create", "/profiles", func(ctx *Context) {
+		bindErr = ctx.Bind(new(profile))
+	})
+	e.PATCH("update", "/profiles", func(ctx *Context) {
+		bindErr = ctx.BindWith(new(profile), binding.JSON, binding.Scenario("update"))
+	})
+
+	serve(e, http.MethodPost, "/profiles", binding.MIME_JSON, `{"email":"a@b.c"}`)
+	assert.Equal(t, bindErr, binding.Errors{"name": "name is a required field"})
+	serve(e, http.MethodPatch, "/profiles", binding.MIME_JSON, `{"email":"a@b.c"}`)
+	assert.Nil(t, bindErr)
+	serve(e, http.MethodPatch, "/profiles", binding.MIME_JSON, `{"email":"nope"}`)
+	assert.Equal(t, bindErr, binding.Errors{"email": "email must be a valid email address"})
+
+	e.PUT("plain", "/profiles", func(ctx *Context) {
+		bindErr = ctx.BindWith(new(profile), plainBinding{}, binding.Scenario("update"))
+	})
+	serve(e, http.MethodPut, "/profiles", "", "")
+	assert.EqualError(t, bindErr, "binding plain does not take bind options")
+}
+
+// plainBinding binds and validates in one step, it is not a Decoder.
+type plainBinding struct{}
+
+func (plainBinding) Name() string { return "plain" }
+
+func (plainBinding) Bind(*http.Request, any) error { return nil }
+
+func TestContextBindPatch(t *testing.T) {
+	type article struct {
+		Title string `json:"title" validate:"required"`
+		Body  string `json:"body"`
+	}
+
+	e := DefaultEngine()
+	stored := article{Title: "draft", Body: "text"}
+	e.PATCH("article", "/article", func(ctx *Context) {
+		if err := ctx.Bind(&stored); err != nil {
+			ctx.Fail(err)
+			return
+		}
+		ctx.String(http.StatusOK, "%s", stored.Title)
+	})
+
+	w := serve(e, http.MethodPatch, "/article", binding.MIME_MergePatch, `{"title":"final"}`)
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, stored, article{Title: "final", Body: "text"})
+
+	w = serve(e, http.MethodPatch, "/article", binding.MIME_JSONPatch, `[{"op":"test","path":"/title","value":"draft"}]`)
+	assert.Equal(t, w.Code, http.StatusConflict)
+	w = serve(e, http.MethodPatch, "/article", binding.MIME_JSONPatch, `[{"op":"remove","path":"/title"}]`)
+	assert.Equal(t, w.Code, http.StatusUnprocessableEntity)
+	assert.Equal(t, stored, article{Title: "final", Body: "text"})
+}
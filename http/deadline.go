@@ -0,0 +1,80 @@
+package http
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// deadline is the context.Context of a request. The cancelable context and
+// its timer are only created when Done is first called, most handlers never
+// do and save the allocations.
+type deadline struct {
+	mu     sync.Mutex
+	at     time.Time
+	ctx    context.Context
+	cancel context.CancelFunc
+	closed bool
+}
+
+func (d *deadline) reset(timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.at = time.Time{}
+	if timeout > 0 {
+		d.at = time.Now().Add(timeout)
+	}
+	d.ctx, d.cancel, d.closed = nil, nil, false
+}
+
+func (d *deadline) Deadline() (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.at, !d.at.IsZero()
+}
+
+func (d *deadline) Done() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ctx == nil {
+		if d.at.IsZero() {
+			d.ctx, d.cancel = context.WithCancel(context.Background())
+		} else {
+			d.ctx, d.cancel = context.WithDeadline(context.Background(), d.at)
+		}
+		if d.closed {
+			d.cancel()
+		}
+	}
+
+	return d.ctx.Done()
+}
+
+func (d *deadline) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case d.ctx != nil:
+		return d.ctx.Err()
+	case d.closed:
+		return context.Canceled
+	case !d.at.IsZero() && !time.Now().Before(d.at):
+		return context.DeadlineExceeded
+	}
+
+	return nil
+}
+
+func (d *deadline) Value(any) any {
+	return nil
+}
+
+// close cancels the context once the request is done.
+func (d *deadline) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
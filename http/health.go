@@ -0,0 +1,130 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"fbnoi.com/gonet/http/render"
+)
+
+const (
+	HealthLiveRoute  = "health.live"
+	HealthReadyRoute = "health.ready"
+)
+
+// HealthCheck is a named probe reported by the health endpoints.
+type HealthCheck struct {
+	Name  string
+	Check func(context.Context) error
+}
+
+type HealthConfig struct {
+	LivePath  string // default /healthz
+	ReadyPath string // default /readyz
+
+	Liveness  []HealthCheck
+	Readiness []HealthCheck
+
+	// Timeout bounds a whole report, checks still running are reported as
+	// failed. Default 1s.
+	Timeout time.Duration
+
+	// DrainDelay is how long Shutdown keeps serving after readiness starts
+	// failing, so that load balancers notice before listeners close.
+	DrainDelay time.Duration
+}
+
+// Health registers the liveness and readiness routes. Checks of a probe run
+// concurrently and the result is reported as JSON with 200 or 503. Readiness
+// fails as soon as Shutdown begins.
+func (e *Engine) Health(conf *HealthConfig) *Engine {
+	c := *conf
+	if c.LivePath == "" {
+		c.LivePath = "/healthz"
+	}
+	if c.ReadyPath == "" {
+		c.ReadyPath = "/readyz"
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = _default_timeout
+	}
+	e.health.Store(&c)
+
+	e.GET(HealthLiveRoute, c.LivePath, func(ctx *Context) {
+		report(ctx, c.Liveness, c.Timeout)
+	})
+	e.GET(HealthReadyRoute, c.ReadyPath, func(ctx *Context) {
+		if e.isDraining() {
+			ctx.JSON(&render.JSON{"status": "draining"}, http.StatusServiceUnavailable)
+			return
+		}
+		report(ctx, c.Readiness, c.Timeout)
+	})
+
+	return e
+}
+
+func isHealthRoute(name string) bool {
+	return name == HealthLiveRoute || name == HealthReadyRoute
+}
+
+func (e *Engine) isDraining() bool {
+	return atomic.LoadInt32(&e.draining) == 1
+}
+
+// drain waits for the configured drain delay or until ctx is done.
+func (e *Engine) drain(ctx context.Context) {
+	c, ok := e.health.Load().(*HealthConfig)
+	if !ok || c.DrainDelay <= 0 {
+		return
+	}
+
+	t := time.NewTimer(c.DrainDelay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+type checkResult struct {
+	name string
+	err  error
+}
+
+func report(ctx *Context, checks []HealthCheck, timeout time.Duration) {
+	// checks may outlive the request, so they must not hold on to ctx.
+	c, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	results := make(chan checkResult, len(checks))
+	for _, hc := range checks {
+		go func(hc HealthCheck) {
+			results <- checkResult{hc.Name, hc.Check(c)}
+		}(hc)
+	}
+
+	status, code := "ok", http.StatusOK
+	detail := make(map[string]string, len(checks))
+	for _, hc := range checks {
+		detail[hc.Name] = "timeout"
+	}
+collect:
+	for range checks {
+		select {
+		case r := <-results:
+			detail[r.name] = "ok"
+			if r.err != nil {
+				detail[r.name] = r.err.Error()
+				status, code = "unavailable", http.StatusServiceUnavailable
+			}
+		case <-c.Done():
+			status, code = "unavailable", http.StatusServiceUnavailable
+			break collect
+		}
+	}
+
+	ctx.JSON(&render.JSON{"status": status, "checks": detail}, code)
+}
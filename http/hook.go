@@ -0,0 +1,144 @@
+package http
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var _default_hook_timeout = 15 * time.Second
+
+// Hook is a function run at a point of the Engine lifecycle.
+type Hook func(context.Context) error
+
+// HookOption configures a registered Hook.
+type HookOption func(*hook)
+
+// HookName names the hook in returned errors.
+func HookName(name string) HookOption {
+	return func(h *hook) { h.name = name }
+}
+
+// HookOrder sets the position of the hook within its phase. Hooks run by
+// ascending order, hooks of the same order run as registered. Default is 0.
+func HookOrder(order int) HookOption {
+	return func(h *hook) { h.order = order }
+}
+
+// HookTimeout bounds how long the hook may run, d <= 0 means no bound
+// other than the context the hook runs in.
+func HookTimeout(d time.Duration) HookOption {
+	return func(h *hook) { h.timeout = d }
+}
+
+type phase int
+
+const (
+	phaseStart phase = iota
+	phaseReady
+	phaseShutdown
+	phaseStop
+)
+
+var phaseNames = [...]string{"start", "ready", "shutdown", "stop"}
+
+type hook struct {
+	fn      Hook
+	name    string
+	order   int
+	timeout time.Duration
+}
+
+type hooks struct {
+	mu    sync.Mutex
+	phase [4][]*hook
+}
+
+// OnStart registers a hook run by Run before the listener is opened. An
+// error aborts Run.
+func (e *Engine) OnStart(fn Hook, opts ...HookOption) *Engine {
+	return e.addHook(phaseStart, fn, opts)
+}
+
+// OnReady registers a hook run once the listener is open. An
+// error aborts Run.
+func (e *Engine) OnReady(fn Hook, opts ...HookOption) *Engine {
+	return e.addHook(phaseReady, fn, opts)
+}
+
+// OnShutdown registers a hook run when Shutdown begins, before the server
+// stops accepting requests.
+func (e *Engine) OnShutdown(fn Hook, opts ...HookOption) *Engine {
+	return e.addHook(phaseShutdown, fn, opts)
+}
+
+// OnStop registers a hook run by Shutdown after the server and background
+// tasks have stopped.
+func (e *Engine) OnStop(fn Hook, opts ...HookOption) *Engine {
+	return e.addHook(phaseStop, fn, opts)
+}
+
+func (e *Engine) addHook(p phase, fn Hook, opts []HookOption) *Engine {
+	h := &hook{fn: fn, timeout: _default_hook_timeout}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	e.hooks.mu.Lock()
+	defer e.hooks.mu.Unlock()
+	list := append(e.hooks.phase[p], h)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].order < list[j].order })
+	e.hooks.phase[p] = list
+
+	return e
+}
+
+// run runs the hooks of phase p in order. Start and ready hooks stop at the
+// first error, shutdown and stop hooks all run and the first error is
+// returned.
+func (hs *hooks) run(ctx context.Context, p phase) (err error) {
+	hs.mu.Lock()
+	list := append([]*hook(nil), hs.phase[p]...)
+	hs.mu.Unlock()
+
+	for i, h := range list {
+		herr := h.run(ctx)
+		if herr == nil {
+			continue
+		}
+		name := h.name
+		if name == "" {
+			name = "#" + strconv.Itoa(i)
+		}
+		herr = errors.Wrapf(herr, "%s hook %s", phaseNames[p], name)
+		if p == phaseStart || p == phaseReady {
+			return herr
+		}
+		if err == nil {
+			err = herr
+		}
+	}
+
+	return
+}
+
+func (h *hook) run(parent context.Context) error {
+	ctx, cancel := context.WithCancel(parent)
+	if h.timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, h.timeout)
+	}
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- h.fn(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LimitError reports a request rejected by a concurrency limit.
+type LimitError struct {
+	Code   int
+	Reason string
+}
+
+func (e *LimitError) Error() string {
+	return e.Reason
+}
+
+func (e *LimitError) StatusCode() int {
+	return e.Code
+}
+
+var (
+	ErrQueueFull    = &LimitError{http.StatusTooManyRequests, "too many requests"}
+	ErrQueueTimeout = &LimitError{http.StatusServiceUnavailable, "timed out waiting for a free slot"}
+)
+
+// LimitStats is a snapshot of a concurrency limit.
+type LimitStats struct {
+	InFlight    int64
+	Queued      int64
+	MaxInFlight int
+	MaxQueue    int
+}
+
+// Limiter decides how many requests of a route run at the same time.
+// Set Config.Limiter to replace the static MaxInFlight limit.
+type Limiter interface {
+	// Acquire blocks until the request may proceed or returns an error,
+	// a *LimitError selects the response status.
+	Acquire(ctx context.Context) error
+
+	// Release frees the slot taken by a successful Acquire and reports how
+	// long the request took and whether it failed: it ended with an error,
+	// a 5xx status or past its deadline.
+	Release(latency time.Duration, failed bool)
+
+	Stats() LimitStats
+}
+
+// limiter admits at most cap(slots) requests at once and lets up to
+// maxQueue more wait for a free slot.
+type limiter struct {
+	slots    chan struct{}
+	maxQueue int
+	timeout  time.Duration
+
+	inFlight int64
+	queued   int64
+}
+
+func newLimiter(c *Config) *limiter {
+	if c.MaxInFlight <= 0 {
+		return nil
+	}
+
+	return &limiter{
+		slots:    make(chan struct{}, c.MaxInFlight),
+		maxQueue: c.MaxQueue,
+		timeout:  c.QueueTimeout,
+	}
+}
+
+func (l *limiter) Acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		atomic.AddInt64(&l.inFlight, 1)
+		return nil
+	default:
+	}
+
+	if q := atomic.AddInt64(&l.queued, 1); q > int64(l.maxQueue) {
+		atomic.AddInt64(&l.queued, -1)
+		return ErrQueueFull
+	}
+	defer atomic.AddInt64(&l.queued, -1)
+
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		t := time.NewTimer(l.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		atomic.AddInt64(&l.inFlight, 1)
+		return nil
+	case <-timeout:
+		return ErrQueueTimeout
+	case <-ctx.Done():
+		return ErrQueueTimeout
+	}
+}
+
+func (l *limiter) Release(time.Duration, bool) {
+	atomic.AddInt64(&l.inFlight, -1)
+	<-l.slots
+}
+
+func (l *limiter) Stats() LimitStats {
+	return LimitStats{
+		InFlight:    atomic.LoadInt64(&l.inFlight),
+		Queued:      atomic.LoadInt64(&l.queued),
+		MaxInFlight: cap(l.slots),
+		MaxQueue:    l.maxQueue,
+	}
+}
+
+// LimitStats returns the gauges of every concurrency limit, keyed by route
+// name. The engine wide limit is keyed by "".
+func (e *Engine) LimitStats() map[string]LimitStats {
+	snap := e.snapshot()
+	stats := make(map[string]LimitStats)
+	if l := snap.conf.limiter; l != nil {
+		stats[""] = l.Stats()
+	}
+	for name, s := range snap.routes {
+		if s.limiter != nil {
+			stats[name] = s.limiter.Stats()
+		}
+	}
+
+	return stats
+}
+
+// statusWriter records the status of a response so that limiters can count
+// server errors as failures.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
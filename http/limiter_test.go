@@ -0,0 +1,130 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// simulate drives l with clients callers per round against a backend that
+// serves capacity requests in 10ms and slows down linearly beyond that. It
+// returns the limit after every round.
+func simulate(l Limiter, clients, capacity, rounds int) []int {
+	limits := make([]int, 0, rounds)
+	for r := 0; r < rounds; r++ {
+		admitted := 0
+		for i := 0; i < clients; i++ {
+			if l.Acquire(context.Background()) == nil {
+				admitted++
+			}
+		}
+		latency := 10 * time.Millisecond
+		if admitted > capacity {
+			latency = latency * time.Duration(admitted) / time.Duration(capacity)
+		}
+		for i := 0; i < admitted; i++ {
+			l.Release(latency, false)
+		}
+		limits = append(limits, l.Stats().MaxInFlight)
+	}
+
+	return limits
+}
+
+func assertSettles(t *testing.T, limits []int, min, max int) {
+	for i, l := range limits[len(limits)/2:] {
+		if l < min || l > max {
+			t.Fatalf("limit %d at round %d is outside [%d, %d]", l, len(limits)/2+i, min, max)
+		}
+	}
+}
+
+func mean(limits []int) float64 {
+	sum := 0
+	for _, l := range limits {
+		sum += l
+	}
+
+	return float64(sum) / float64(len(limits))
+}
+
+func TestAIMDLimiter(t *testing.T) {
+	l := NewAIMDLimiter(AIMDConfig{InitialLimit: 10, MaxLimit: 100, Threshold: 15 * time.Millisecond})
+
+	// The backend exceeds the threshold above 30 concurrent requests.
+	assertSettles(t, simulate(l, 100, 20, 200), 25, 31)
+
+	for i := 0; i < l.Stats().MaxInFlight; i++ {
+		assert.Nil(t, l.Acquire(context.Background()))
+	}
+	assert.Equal(t, l.Acquire(context.Background()), ErrLimitExceeded)
+	before := l.Stats().MaxInFlight
+	l.Release(time.Millisecond, true)
+	assert.Less(t, l.Stats().MaxInFlight, before)
+}
+
+func TestGradientLimiter(t *testing.T) {
+	l := NewGradientLimiter(GradientConfig{InitialLimit: 10, MaxLimit: 100})
+
+	// The limit oscillates around the point where the backend gets slower
+	// than tolerated.
+	slow := simulate(l, 100, 20, 200)[100:]
+	assertSettles(t, slow, 20, 50)
+	assert.InDelta(t, mean(slow), 30, 5)
+
+	// A faster backend lets the limit grow.
+	fast := simulate(l, 100, 40, 200)[100:]
+	assert.Greater(t, mean(fast), mean(slow))
+	assert.Less(t, l.Stats().MaxInFlight, 100)
+}
+
+func TestEngineAdaptiveLimit(t *testing.T) {
+	e := DefaultEngine()
+	block := make(chan struct{})
+	e.GET("slow", "/slow", func(ctx *Context) { <-block })
+	assert.Nil(t, e.SetRouteConfig("slow", &Config{
+		TimeOut: time.Second,
+		Limiter: NewAIMDLimiter(AIMDConfig{InitialLimit: 1, MaxLimit: 1}),
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		serve(e, "GET", "/slow", "", "")
+		close(done)
+	}()
+	for e.LimitStats()["slow"].InFlight == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, serve(e, "GET", "/slow", "", "").Code, http.StatusServiceUnavailable)
+	close(block)
+	<-done
+}
+
+// recordLimiter admits every request and records the failed flags.
+type recordLimiter struct {
+	failed []bool
+}
+
+func (l *recordLimiter) Acquire(context.Context) error { return nil }
+
+func (l *recordLimiter) Release(_ time.Duration, failed bool) { l.failed = append(l.failed, failed) }
+
+func (l *recordLimiter) Stats() LimitStats { return LimitStats{} }
+
+func TestEngineLimitFailures(t *testing.T) {
+	e := DefaultEngine()
+	l := &recordLimiter{}
+	e.GET("code", "/code/:code", func(ctx *Context) {
+		code, _ := ctx.ParamInt("code")
+		ctx.String(code, "done")
+	})
+	assert.Nil(t, e.SetRouteConfig("code", &Config{TimeOut: time.Second, Limiter: l}))
+
+	for _, code := range []string{"200", "404", "500", "503"} {
+		assert.Equal(t, serve(e, "GET", "/code/"+code, "", "").Body.String(), "done")
+	}
+	assert.Equal(t, l.failed, []bool{false, false, true, true})
+}
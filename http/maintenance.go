@@ -0,0 +1,138 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fbnoi.com/gonet/http/render"
+	"github.com/pkg/errors"
+)
+
+var (
+	_default_maintenance_html = "<h1>Service Unavailable</h1><p>The service is under maintenance, please try again later.</p>"
+	_default_maintenance_json = render.JSON{"error": "service is under maintenance"}
+)
+
+// Maintenance makes matching requests fail with 503 Service Unavailable.
+type Maintenance struct {
+	// RetryAfter is sent in the Retry-After header when positive.
+	RetryAfter time.Duration
+
+	// Allow lists client IPs or CIDRs that keep being served.
+	Allow []string
+
+	// HTML is the body sent to browsers, JSON the body sent to clients
+	// accepting application/json.
+	HTML string
+	JSON render.JSON
+}
+
+type maintenance struct {
+	conf  *Maintenance
+	allow []*net.IPNet
+}
+
+type maintenances struct {
+	lock   sync.RWMutex
+	engine *maintenance
+	routes map[string]*maintenance
+}
+
+// SetMaintenance puts the whole engine into maintenance, a nil m turns it
+// off. Health routes are never affected.
+func (e *Engine) SetMaintenance(m *Maintenance) error {
+	mt, err := compileMaintenance(m)
+	if err != nil {
+		return err
+	}
+
+	e.maintenance.lock.Lock()
+	defer e.maintenance.lock.Unlock()
+	e.maintenance.engine = mt
+
+	return nil
+}
+
+// SetRouteMaintenance puts the named routes into maintenance, a nil m turns
+// it off.
+func (e *Engine) SetRouteMaintenance(m *Maintenance, names ...string) error {
+	mt, err := compileMaintenance(m)
+	if err != nil {
+		return err
+	}
+
+	e.maintenance.lock.Lock()
+	defer e.maintenance.lock.Unlock()
+	if e.maintenance.routes == nil {
+		e.maintenance.routes = make(map[string]*maintenance)
+	}
+	for _, name := range names {
+		if mt == nil {
+			delete(e.maintenance.routes, name)
+		} else {
+			e.maintenance.routes[name] = mt
+		}
+	}
+
+	return nil
+}
+
+func (e *Engine) routeMaintenance(name string) *maintenance {
+	if isHealthRoute(name) {
+		return nil
+	}
+
+	e.maintenance.lock.RLock()
+	defer e.maintenance.lock.RUnlock()
+	if m, ok := e.maintenance.routes[name]; ok {
+		return m
+	}
+
+	return e.maintenance.engine
+}
+
+func compileMaintenance(m *Maintenance) (*maintenance, error) {
+	if m == nil {
+		return nil, nil
+	}
+	if m.RetryAfter < 0 {
+		return nil, errors.New("RetryAfter cannot less than 0.")
+	}
+
+	allow, err := parseNets(m.Allow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &maintenance{conf: m, allow: allow}, nil
+}
+
+func (m *maintenance) allows(ip net.IP) bool {
+	return containsIP(m.allow, ip)
+}
+
+func (m *maintenance) serve(ctx *Context) {
+	if m.conf.RetryAfter > 0 {
+		secs := int64((m.conf.RetryAfter + time.Second - 1) / time.Second)
+		ctx.ResponseWriter.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	}
+
+	if strings.Contains(ctx.Request.Header.Get("Accept"), "json") {
+		body := m.conf.JSON
+		if body == nil {
+			body = _default_maintenance_json
+		}
+		ctx.JSON(&body, http.StatusServiceUnavailable)
+		return
+	}
+
+	body := m.conf.HTML
+	if body == "" {
+		body = _default_maintenance_html
+	}
+	ctx.Bytes(http.StatusServiceUnavailable, render.CONTENT_TYPE_HTML, []byte(body))
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"log"
+	"net/http"
+
+	"fbnoi.com/gonet/http/binding"
+	"fbnoi.com/gonet/http/render"
+	"fbnoi.com/httprouter"
+	"github.com/pkg/errors"
+)
+
+// Option configures an Engine built by New.
+type Option func(*Engine) error
+
+// ErrorHandler writes the response for an error passed to Context.Fail.
+type ErrorHandler func(*Context, error)
+
+// New returns an Engine with the default config, adjusted by opts.
+func New(opts ...Option) (*Engine, error) {
+	e := &Engine{
+		routerConf: &httprouter.Config{},
+		validator:  binding.NewValidator(),
+	}
+	if err := e.SetConfig(&Config{MaxMemory: _default_memory, TimeOut: _default_timeout}); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		if err := opt(e); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// WithRedirectTrailingSlash redirects to the path with or without a
+// trailing slash when only that one has a route.
+func WithRedirectTrailingSlash(on bool) Option {
+	return func(e *Engine) error {
+		e.routerConf.RedirectTrailingSlash = on
+		return nil
+	}
+}
+
+// WithRedirectFixedPath redirects to the cleaned path, e.g. /FOO/../bar to
+// /bar, when it has a route.
+func WithRedirectFixedPath(on bool) Option {
+	return func(e *Engine) error {
+		e.routerConf.RedirectFixedPath = on
+		return nil
+	}
+}
+
+// WithCaseInsensitive matches request paths without regard to case.
+// Handlers see the request path and route params as they were sent.
+func WithCaseInsensitive(on bool) Option {
+	return func(e *Engine) error {
+		e.caseInsensitive = on
+		return nil
+	}
+}
+
+// WithConfig replaces the default engine config.
+func WithConfig(conf *Config) Option {
+	return func(e *Engine) error {
+		return e.SetConfig(conf)
+	}
+}
+
+// WithLogger sets where the engine logs, default is the standard logger.
+func WithLogger(l *log.Logger) Option {
+	return func(e *Engine) error {
+		e.logger = l
+		return nil
+	}
+}
+
+// WithValidator sets the validator used by Context.Bind and BindWith,
+// default is a new binding.Validator for each engine.
+func WithValidator(v binding.StructValidator) Option {
+	return func(e *Engine) error {
+		e.validator = v
+		return nil
+	}
+}
+
+// WithRenderer sets the renderer of Context.HTML, default is
+// template.Render.
+func WithRenderer(r render.TemplateRenderer) Option {
+	return func(e *Engine) error {
+		e.renderer = r
+		return nil
+	}
+}
+
+// WithErrorHandler sets the handler of Context.Fail.
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(e *Engine) error {
+		e.errorHandler = h
+		return nil
+	}
+}
+
+// WithTrustedProxies lists the IPs or CIDRs of the proxies whose
+// X-Forwarded-For and X-Real-IP headers Context.ClientIP believes.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(e *Engine) (err error) {
+		e.trustedProxies, err = parseNets(proxies)
+		return errors.Wrap(err, "trusted proxies")
+	}
+}
+
+// Validator returns the validator of Context.Bind and BindWith, rules
+// registered on it apply to this engine only.
+func (e *Engine) Validator() binding.StructValidator {
+	if e == nil || e.validator == nil {
+		return binding.DefaultValidator
+	}
+
+	return e.validator
+}
+
+// validate checks obj with the engine validator, translating the errors
+// to the Accept-Language of r.
+func (e *Engine) validate(r *http.Request, obj any, opts ...binding.BindOption) error {
+	return binding.Validate(e.Validator(), r, obj, opts...)
+}
+
+func (e *Engine) log() *log.Logger {
+	if e == nil || e.logger == nil {
+		return log.Default()
+	}
+
+	return e.logger
+}
+
+// defaultErrorHandler answers with the status of errors that have a
+// StatusCode method and 500 otherwise, errors that can render themselves,
+// like binding.Errors, write the body. Messages of other errors without a
+// status are not shown to the client.
+func defaultErrorHandler(ctx *Context, err error) {
+	code := http.StatusInternalServerError
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		code = sc.StatusCode()
+	}
+	var r render.Render
+	if errors.As(err, &r) {
+		ctx.Render(code, r)
+		return
+	}
+	if sc == nil {
+		ctx.Engine.log().Printf("%s %s: %+v", ctx.Request.Method, ctx.Request.URL.Path, err)
+		ctx.String(code, "%s", http.StatusText(code))
+		return
+	}
+	ctx.String(code, "%s", err)
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Plugin bundles routes, middleware, config and hooks that are installed
+// together by Engine.Register.
+type Plugin interface {
+	Name() string
+	Install(*Engine) error
+}
+
+type plugins struct {
+	mu        sync.Mutex
+	installed map[string]Plugin
+}
+
+// Register installs plugins in order. A plugin name can be registered only
+// once.
+func (e *Engine) Register(ps ...Plugin) error {
+	for _, p := range ps {
+		if err := e.plugins.reserve(p); err != nil {
+			return err
+		}
+		if err := p.Install(e); err != nil {
+			e.plugins.release(p)
+			return errors.Wrapf(err, "plugin %s", p.Name())
+		}
+	}
+
+	return nil
+}
+
+func (ps *plugins) reserve(p Plugin) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if _, ok := ps.installed[p.Name()]; ok {
+		return errors.Errorf("plugin %s is already registered", p.Name())
+	}
+	if ps.installed == nil {
+		ps.installed = make(map[string]Plugin)
+	}
+	ps.installed[p.Name()] = p
+
+	return nil
+}
+
+func (ps *plugins) release(p Plugin) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.installed, p.Name())
+}
@@ -11,8 +11,12 @@ type Data struct {
 	Data        [][]byte
 }
 
-func (d Data) Render(w http.ResponseWriter) (err error) {
+func (d Data) WriteContentType(w http.ResponseWriter) {
 	writeHeader(w, d.ContentType)
+}
+
+func (d Data) Render(w http.ResponseWriter) (err error) {
+	d.WriteContentType(w)
 	for _, d := range d.Data {
 		if _, err = w.Write(d); err != nil {
 			err = errors.WithStack(err)
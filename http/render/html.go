@@ -1,6 +1,7 @@
 package render
 
 import (
+	"io"
 	"net/http"
 
 	"fbnoi.com/template"
@@ -8,13 +9,28 @@ import (
 
 const CONTENT_TYPE_HTML = "text/html; charset=utf-8"
 
+// TemplateRenderer renders the view at path with ps.
+type TemplateRenderer interface {
+	Render(path string, w io.Writer, ps template.Params) error
+}
+
 type HTML struct {
 	ViewPath string
 	Params   template.Params
+
+	// Renderer renders the view, nil uses template.Render.
+	Renderer TemplateRenderer
 }
 
-func (h HTML) Render(w http.ResponseWriter) (err error) {
+func (h HTML) WriteContentType(w http.ResponseWriter) {
 	writeHeader(w, CONTENT_TYPE_HTML)
+}
+
+func (h HTML) Render(w http.ResponseWriter) (err error) {
+	h.WriteContentType(w)
+	if h.Renderer != nil {
+		return h.Renderer.Render(h.ViewPath, w, h.Params)
+	}
 	err = template.Render(h.ViewPath, w, h.Params)
 
 	return
@@ -11,8 +11,12 @@ const CONTENT_TYPE_JSON = "application/json; charset=utf-8"
 
 type JSON map[string]any
 
-func (j *JSON) Render(w http.ResponseWriter) (err error) {
+func (j *JSON) WriteContentType(w http.ResponseWriter) {
 	writeHeader(w, CONTENT_TYPE_JSON)
+}
+
+func (j *JSON) Render(w http.ResponseWriter) (err error) {
+	j.WriteContentType(w)
 	if err = json.NewEncoder(w).Encode(j); err != nil {
 		err = errors.WithStack(err)
 	}
@@ -10,6 +10,12 @@ type Render interface {
 	Render(w http.ResponseWriter) error
 }
 
+// ContentTyper is implemented by renders that know their Content-Type
+// before the body is written, so it can be set ahead of the status.
+type ContentTyper interface {
+	WriteContentType(w http.ResponseWriter)
+}
+
 func writeHeader(w http.ResponseWriter, contentType string) {
 	if w.Header().Get("Content-Type") == "" {
 		w.Header().Set("Content-Type", contentType)
@@ -0,0 +1,48 @@
+package render
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	type user struct {
+		Name string `xml:"name" yaml:"name"`
+		Age  int    `xml:"age" yaml:"age"`
+	}
+	tests := []struct {
+		name        string
+		r           Render
+		contentType string
+		body        string
+	}{
+		{"json", &JSON{"x": 1}, "application/json; charset=utf-8", "{\"x\":1}\n"},
+		{"xml", XML{Data: user{"bob", 7}}, "application/xml; charset=utf-8", "<user><name>bob</name><age>7</age></user>"},
+		{"yaml", YAML{Data: user{"bob", 7}}, "application/yaml; charset=utf-8", "name: bob\nage: 7\n"},
+		{"yaml list", YAML{Data: []string{"a", "b"}}, "application/yaml; charset=utf-8", "- a\n- b\n"},
+		{"string", String{Format: "%s=%d", Data: []interface{}{"x", 1}}, "text/plain; charset=utf-8", "x=1"},
+		{"data", Data{ContentType: "image/png", Data: [][]byte{[]byte("a"), []byte("b")}}, "image/png", "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			assert.Nil(t, tt.r.Render(w))
+			assert.Equal(t, w.Result().Header.Get("Content-Type"), tt.contentType)
+			assert.Equal(t, w.Body.String(), tt.body)
+		})
+	}
+}
+
+func TestRenderKeepsContentType(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/x-yaml")
+	assert.Nil(t, YAML{Data: 1}.Render(w))
+	assert.Equal(t, w.Result().Header.Get("Content-Type"), "application/x-yaml")
+}
+
+func TestYAMLError(t *testing.T) {
+	w := httptest.NewRecorder()
+	assert.Error(t, YAML{Data: func() {}}.Render(w))
+}
@@ -15,8 +15,12 @@ type String struct {
 	Data   []interface{}
 }
 
-func (s String) Render(w http.ResponseWriter) (err error) {
+func (s String) WriteContentType(w http.ResponseWriter) {
 	writeHeader(w, plain_content_type)
+}
+
+func (s String) Render(w http.ResponseWriter) (err error) {
+	s.WriteContentType(w)
 	if len(s.Data) > 0 {
 		_, err = fmt.Fprintf(w, s.Format, s.Data...)
 	} else {
@@ -13,8 +13,12 @@ type XML struct {
 	Data any
 }
 
-func (x XML) Render(w http.ResponseWriter) (err error) {
+func (x XML) WriteContentType(w http.ResponseWriter) {
 	writeHeader(w, content_type_xml)
+}
+
+func (x XML) Render(w http.ResponseWriter) (err error) {
+	x.WriteContentType(w)
 	if err = xml.NewEncoder(w).Encode(x.Data); err != nil {
 		err = errors.WithStack(err)
 	}
@@ -0,0 +1,36 @@
+package render
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const content_type_yaml = "application/yaml; charset=utf-8"
+
+type YAML struct {
+	Data any
+}
+
+func (y YAML) WriteContentType(w http.ResponseWriter) {
+	writeHeader(w, content_type_yaml)
+}
+
+func (y YAML) Render(w http.ResponseWriter) (err error) {
+	y.WriteContentType(w)
+	// yaml.v3 panics on values it cannot encode, like funcs and channels
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("yaml: cannot encode %T: %v", y.Data, r)
+		}
+	}()
+	enc := yaml.NewEncoder(w)
+	if err = enc.Encode(y.Data); err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		err = errors.WithStack(err)
+	}
+	return
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"fbnoi.com/gonet/http/binding"
 	"fbnoi.com/handler"
 	"fbnoi.com/httprouter"
+	"github.com/pkg/errors"
 )
 
 func (e *Engine) GET(name, path string, fn func(*Context), mds ...func(*Context, func(*Context))) *Engine {
@@ -33,55 +38,372 @@ func (e *Engine) DELETE(name, path string, fn func(*Context), mds ...func(*Conte
 	return e.Handle(name, "DELETE", path, fn, mds...)
 }
 
-func (e *Engine) All(name, path string, fn func(*Context), mds ...func(*Context, func(*Context))) *Engine {
-	h := wrapHandler(fn, mds...)
-	e.router.All(name, path, func(r *http.Request, w http.ResponseWriter, ps httprouter.Params) {
-		e.handle(r, w, ps, h)
-	})
+// Use appends global middlewares. They run before the route middlewares of
+// every route, whether registered before or after Use.
+func (e *Engine) Use(mds ...func(*Context, func(*Context))) *Engine {
+	e.routes.lock.Lock()
+	defer e.routes.lock.Unlock()
+	e.middlewares = append(e.middlewares, mds...)
+	for _, rt := range e.routes.list {
+		rt.wrap(e)
+	}
 
 	return e
 }
 
+func (e *Engine) All(name, path string, fn func(*Context), mds ...func(*Context, func(*Context))) *Engine {
+	return e.must(e.addRoute(name, "", path, true, fn, mds))
+}
+
+// Handle registers the route name. Routes may be registered while the
+// engine serves, registering an existing name replaces that route. It
+// panics when the router rejects the path, e.g. a conflicting one, and the
+// routes served before stay in place.
 func (e *Engine) Handle(name, method, path string, fn func(*Context), mds ...func(*Context, func(*Context))) *Engine {
-	h := wrapHandler(fn, mds...)
-	e.router.Handle(name, method, path, func(r *http.Request, w http.ResponseWriter, ps httprouter.Params) {
-		e.handle(r, w, ps, h)
-	})
+	return e.must(e.AddRoute(name, method, path, fn, mds...))
+}
+
+// AddRoute registers the route name like Handle, but returns the error of
+// a path the router rejects instead of panicking.
+func (e *Engine) AddRoute(name, method, path string, fn func(*Context), mds ...func(*Context, func(*Context))) error {
+	return e.addRoute(name, method, path, false, fn, mds)
+}
+
+func (e *Engine) must(err error) *Engine {
+	if err != nil {
+		panic(err)
+	}
 
 	return e
 }
 
-func wrapHandler(fn func(*Context), mds ...func(*Context, func(*Context))) *handler.Handler[*Context] {
-	return handler.New[*Context]().Then(mds...).Final(fn)
+// addRoute adds a new route to the router being built when the engine has
+// not served yet, so registering n routes at startup does not build n
+// routers. Other changes build a new router.
+func (e *Engine) addRoute(name, method, path string, all bool, fn func(*Context), mds []func(*Context, func(*Context))) error {
+	e.routes.lock.Lock()
+	defer e.routes.lock.Unlock()
+
+	rt, ok := e.routes.byName[name]
+	if ok && rt.method == method && rt.path == path && rt.all == all {
+		rt.fn, rt.mds = fn, mds
+		rt.wrap(e)
+		return nil
+	}
+
+	rt = &route{name: name, method: method, path: path, all: all, fn: fn, mds: mds}
+	rt.wrap(e)
+	if t := e.routes.tree; !ok && t != nil {
+		if err := rt.register(e, t); err != nil {
+			// the router may be half changed, build the next one anew
+			e.routes.tree = nil
+			return err
+		}
+		e.routes.set(rt)
+		return nil
+	}
+	list, byName := e.routes.clone()
+	e.routes.set(rt)
+	if err := e.rebuild(); err != nil {
+		e.routes.list, e.routes.byName = list, byName
+		return err
+	}
+
+	return nil
 }
 
-func (e *Engine) handle(r *http.Request, w http.ResponseWriter, ps httprouter.Params, h *handler.Handler[*Context]) {
-	conf := e.config()
-	rConf, ok := e.routeConfig(ps.GetRoute().RouteName())
+// Replace atomically swaps the handler chain of the route name. Requests
+// already running finish with the old chain.
+func (e *Engine) Replace(name string, fn func(*Context), mds ...func(*Context, func(*Context))) error {
+	e.routes.lock.Lock()
+	defer e.routes.lock.Unlock()
+
+	rt, ok := e.routes.byName[name]
+	if !ok {
+		return errors.Errorf("route %s does not exist", name)
+	}
+	rt.fn, rt.mds = fn, mds
+	rt.wrap(e)
 
-	mem, t := conf.MaxMemory, conf.TimeOut
-	if ok {
-		mem, t = rConf.MaxMemory, rConf.TimeOut
+	return nil
+}
+
+// Remove unregisters the route name. Requests already running finish.
+func (e *Engine) Remove(name string) error {
+	e.routes.lock.Lock()
+	defer e.routes.lock.Unlock()
+
+	if _, ok := e.routes.byName[name]; !ok {
+		return errors.Errorf("route %s does not exist", name)
+	}
+	list, byName := e.routes.clone()
+	e.routes.remove(name)
+	if err := e.rebuild(); err != nil {
+		e.routes.list, e.routes.byName = list, byName
+		return err
+	}
+
+	return nil
+}
+
+func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if e.caseInsensitive {
+		r = lowerPath(r)
+	}
+	e.tree().ServeHTTP(w, r)
+}
+
+// originalRequest is the context key of the request whose path lowerPath
+// lower-cased.
+type originalRequest struct{}
+
+// lowerPath returns r with a lower-cased path for routing, the original
+// request is kept in its context for the handler.
+func lowerPath(r *http.Request) *http.Request {
+	p := strings.ToLower(r.URL.Path)
+	if p == r.URL.Path {
+		return r
+	}
+	r2 := r.WithContext(context.WithValue(r.Context(), originalRequest{}, r))
+	u := *r.URL
+	u.Path, u.RawPath = p, ""
+	r2.URL = &u
+
+	return r2
+}
+
+// Params are the route params of a request, with the case of the request
+// path when routes are matched case-insensitively.
+type Params interface {
+	ByName(name string) string
+	GetRoute() *httprouter.Route
+}
+
+// caseParams gives the route params of a lower-cased request the case of
+// the original path.
+type caseParams struct {
+	httprouter.Params
+	pattern, path string
+}
+
+func (p caseParams) ByName(name string) string {
+	v := p.Params.ByName(name)
+	segs, orig := strings.Split(p.pattern, "/"), strings.Split(p.path, "/")
+	for i := 0; i < len(segs) && i < len(orig); i++ {
+		var cands []string
+		switch segs[i] {
+		case ":" + name:
+			cands = []string{orig[i]}
+		case "*" + name:
+			rest := strings.Join(orig[i:], "/")
+			cands = []string{rest, "/" + rest}
+		}
+		for _, c := range cands {
+			if strings.ToLower(c) == v {
+				return c
+			}
+		}
+	}
+
+	return v
+}
+
+// tree returns the router of the current routes. Once served, a router is
+// never modified: changing routes builds a new router and swaps it in.
+func (e *Engine) tree() *httprouter.RouteTree {
+	if t, _ := e.router.Load().(*httprouter.RouteTree); t != nil {
+		return t
+	}
+
+	// the first request serves the router built so far
+	e.routes.lock.Lock()
+	defer e.routes.lock.Unlock()
+	if t, _ := e.router.Load().(*httprouter.RouteTree); t != nil {
+		return t
+	}
+	if e.routes.tree == nil {
+		if err := e.rebuild(); err != nil {
+			panic(err)
+		}
 	}
-	contentType := r.Header.Get("Content-Type")
-	if strings.Contains(contentType, "multipart/form-data") {
-		r.ParseMultipartForm(mem)
+	t := e.routes.tree
+	e.routes.tree = nil
+	e.router.Store(t)
+
+	return t
+}
+
+// rebuild builds the router of the current routes, it must be called with
+// the routes lock held. Before the engine serves it is kept to add routes
+// to, after that it is swapped in. When the router rejects a route, e.g. a
+// conflicting path, the error is returned and the router in use is kept.
+func (e *Engine) rebuild() error {
+	t := httprouter.NewRouteTree(e.routerConf)
+	for _, rt := range e.routes.list {
+		if err := rt.register(e, t); err != nil {
+			return err
+		}
+	}
+	if e.router.Load() == nil {
+		e.routes.tree = t
 	} else {
-		r.ParseForm()
+		e.router.Store(t)
+	}
+
+	return nil
+}
+
+type route struct {
+	name, method, path string
+	all                bool
+
+	// fn and mds are wrapped with the global middlewares into h, they are
+	// guarded by the routes lock.
+	fn  func(*Context)
+	mds []func(*Context, func(*Context))
+	h   atomic.Value // *handler.Handler[*Context]
+}
+
+// wrap stores the handler chain of rt, it must be called with the routes
+// lock held.
+func (rt *route) wrap(e *Engine) {
+	rt.h.Store(e.wrapHandler(rt.fn, rt.mds...))
+}
+
+// register adds rt to t, returning the error of a path t rejects.
+func (rt *route) register(e *Engine, t *httprouter.RouteTree) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("%v", r)
+		}
+	}()
+	path := rt.path
+	if e.caseInsensitive {
+		path = lowerStatic(path)
 	}
-	var cancel func()
-	ctx := &Context{
-		Request:        r,
-		ResponseWriter: w,
-		Engine:         e,
-		RouteParams:    ps,
+	h := func(r *http.Request, w http.ResponseWriter, ps httprouter.Params) {
+		var params Params = ps
+		if orig, ok := r.Context().Value(originalRequest{}).(*http.Request); ok {
+			r, params = orig, caseParams{ps, rt.path, orig.URL.Path}
+		}
+		e.handle(r, w, params, rt.h.Load().(*handler.Handler[*Context]))
 	}
-	if t > 0 {
-		ctx.Context, cancel = context.WithTimeout(context.Background(), t)
+	if rt.all {
+		t.All(rt.name, path, h)
 	} else {
-		ctx.Context, cancel = context.WithCancel(context.Background())
+		t.Handle(rt.name, rt.method, path, h)
+	}
+
+	return nil
+}
+
+// lowerStatic lower-cases the static segments of a route path, param names
+// keep their case.
+func lowerStatic(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if !strings.HasPrefix(seg, ":") && !strings.HasPrefix(seg, "*") {
+			segs[i] = strings.ToLower(seg)
+		}
+	}
+
+	return strings.Join(segs, "/")
+}
+
+type routes struct {
+	lock   sync.Mutex
+	list   []*route
+	byName map[string]*route
+	tree   *httprouter.RouteTree // built but not served yet
+}
+
+// clone copies the route list and index so a failed change can be undone.
+func (rs *routes) clone() ([]*route, map[string]*route) {
+	byName := make(map[string]*route, len(rs.byName))
+	for name, rt := range rs.byName {
+		byName[name] = rt
+	}
+
+	return append([]*route(nil), rs.list...), byName
+}
+
+func (rs *routes) set(rt *route) {
+	if _, ok := rs.byName[rt.name]; ok {
+		rs.remove(rt.name)
+	}
+	if rs.byName == nil {
+		rs.byName = make(map[string]*route)
+	}
+	rs.byName[rt.name] = rt
+	rs.list = append(rs.list, rt)
+}
+
+func (rs *routes) remove(name string) {
+	delete(rs.byName, name)
+	for i, rt := range rs.list {
+		if rt.name == name {
+			rs.list = append(rs.list[:i:i], rs.list[i+1:]...)
+			return
+		}
+	}
+}
+
+func (e *Engine) wrapHandler(fn func(*Context), mds ...func(*Context, func(*Context))) *handler.Handler[*Context] {
+	return handler.New[*Context]().Then(e.middlewares...).Then(mds...).Final(fn)
+}
+
+// handle serves r with h.
+func (e *Engine) handle(r *http.Request, w http.ResponseWriter, ps Params, h *handler.Handler[*Context]) {
+	name := ps.GetRoute().RouteName()
+	conf := e.routeConfig(name)
+	if conf.MaxBodyBytes > 0 {
+		binding.LimitBody(r, conf.MaxBodyBytes)
+	}
+
+	ctx, _ := e.pool.Get().(*Context)
+	if ctx == nil {
+		ctx = new(Context)
+	}
+	ctx.reset(e, r, w, ps, conf)
+	defer e.release(ctx)
+
+	if m := e.routeMaintenance(name); m != nil && !m.allows(ctx.ClientIP()) {
+		m.serve(ctx)
+		return
+	}
+	if l := conf.limiter; l != nil && !isHealthRoute(name) {
+		if err := l.Acquire(ctx); err != nil {
+			code := http.StatusServiceUnavailable
+			var le *LimitError
+			if !errors.As(err, &le) {
+				err = &LimitError{code, err.Error()}
+			}
+			ctx.Fail(err)
+			return
+		}
+		sw := &statusWriter{ResponseWriter: ctx.ResponseWriter}
+		ctx.ResponseWriter = sw
+		start := time.Now()
+		defer func() {
+			failed := ctx.Error != nil || sw.status >= http.StatusInternalServerError
+			l.Release(time.Since(start), failed || ctx.Err() == context.DeadlineExceeded)
+		}()
 	}
-	defer cancel()
 
 	h.Handle(ctx)
 }
+
+// release returns ctx to the pool once the request is done. A Context must
+// not be used after its handler returns, use Copy to keep one.
+func (e *Engine) release(ctx *Context) {
+	ctx.deadline.close()
+	ctx.Request, ctx.ResponseWriter, ctx.Error = nil, nil, nil
+	ctx.Engine, ctx.RouteParams = nil, httprouter.Params{}
+	ctx.query, ctx.formErr = nil, nil
+	ctx.mu.Lock()
+	for k := range ctx.store {
+		delete(ctx.store, k)
+	}
+	ctx.mu.Unlock()
+	e.pool.Put(ctx)
+}
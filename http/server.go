@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"fbnoi.com/gonet/http/binding"
+	"fbnoi.com/gonet/http/render"
 	"fbnoi.com/httprouter"
 	"github.com/pkg/errors"
 )
@@ -19,68 +22,164 @@ var (
 	_default_timeout time.Duration = 1 * time.Second
 )
 
+// DefaultEngine returns an Engine that redirects requests to their fixed
+// path.
 func DefaultEngine() *Engine {
-	return &Engine{
-		router: httprouter.NewRouteTree(&httprouter.Config{RedirectFixedPath: true}),
-		conf:   &Config{_default_memory, _default_timeout},
+	e, err := New(WithRedirectFixedPath(true))
+	if err != nil {
+		panic(err)
 	}
+
+	return e
 }
 
 type Config struct {
 	MaxMemory int64
 	TimeOut   time.Duration
+
+	// MaxBodyBytes caps the request body, 0 means no limit. Reading past
+	// it fails with *binding.BodyTooLargeError, which maps to 413.
+	MaxBodyBytes int64
+
+	// MaxInFlight caps the requests served at the same time, 0 means no
+	// limit. Requests over the cap wait in a queue of MaxQueue entries for
+	// at most QueueTimeout, or until the request times out. Requests that
+	// find the queue full get 429, requests that time out in it get 503.
+	MaxInFlight  int
+	MaxQueue     int
+	QueueTimeout time.Duration
+
+	// Limiter replaces the static limit above, e.g. with an adaptive one.
+	// Configs sharing a Limiter share its capacity.
+	Limiter Limiter
+}
+
+// settings is a Config with the runtime state built from it.
+type settings struct {
+	*Config
+	limiter Limiter
+}
+
+func newSettings(conf *Config) *settings {
+	s := &settings{Config: conf, limiter: conf.Limiter}
+	if s.limiter == nil {
+		if l := newLimiter(conf); l != nil {
+			s.limiter = l
+		}
+	}
+
+	return s
+}
+
+func validateConfig(conf *Config) error {
+	if conf.TimeOut < 0 {
+		return errors.New("Timeout cannot less than 0.")
+	}
+	if conf.MaxBodyBytes < 0 {
+		return errors.New("MaxBodyBytes cannot less than 0.")
+	}
+	if conf.MaxInFlight < 0 || conf.MaxQueue < 0 || conf.QueueTimeout < 0 {
+		return errors.New("Concurrency limits cannot less than 0.")
+	}
+
+	return nil
 }
 
 type Engine struct {
 	server atomic.Value
 
-	router *httprouter.RouteTree
+	routerConf      *httprouter.Config
+	router          atomic.Value
+	routes          routes
+	caseInsensitive bool
+
+	logger         *log.Logger
+	validator      binding.StructValidator
+	renderer       render.TemplateRenderer
+	errorHandler   ErrorHandler
+	trustedProxies []*net.IPNet
+
+	// lock serializes config writers, readers load the snapshot in conf
+	// without locking.
+	lock sync.Mutex
+	conf atomic.Value
+
+	pool sync.Pool
+
+	middlewares []func(*Context, func(*Context))
+
+	health   atomic.Value
+	draining int32
+
+	maintenance maintenances
+
+	bg      background
+	hooks   hooks
+	plugins plugins
+}
+
+// snapshot is the config of the engine and its routes. It is never
+// modified once stored, setters store a new one.
+type snapshot struct {
+	conf   *settings
+	routes map[string]*settings
+}
 
-	lock sync.RWMutex
-	conf *Config
+func (e *Engine) snapshot() *snapshot {
+	s, _ := e.conf.Load().(*snapshot)
+	if s == nil {
+		return &snapshot{conf: newSettings(&Config{})}
+	}
 
-	rLock        sync.RWMutex
-	routeConfigs map[string]*Config
+	return s
 }
 
 func (e *Engine) SetConfig(conf *Config) error {
-	if conf.TimeOut < 0 {
-		return errors.New("Timeout cannot less than 0.")
+	if err := validateConfig(conf); err != nil {
+		return err
 	}
 
 	e.lock.Lock()
 	defer e.lock.Unlock()
-	e.conf = conf
+	s := *e.snapshot()
+	s.conf = newSettings(conf)
+	e.conf.Store(&s)
 
 	return nil
 }
 
-func (e *Engine) config() (c *Config) {
-	e.lock.Lock()
-	defer e.lock.Unlock()
-	c = e.conf
-
-	return
+func (e *Engine) config() *settings {
+	return e.snapshot().conf
 }
 
 func (e *Engine) SetRouteConfig(name string, conf *Config) error {
-	if conf.TimeOut < 0 {
-		return errors.New("Timeout cannot less than 0.")
+	if err := validateConfig(conf); err != nil {
+		return err
 	}
 
-	e.rLock.Lock()
-	defer e.rLock.Unlock()
-	e.routeConfigs[name] = conf
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	s := *e.snapshot()
+	routes := make(map[string]*settings, len(s.routes)+1)
+	for n, c := range s.routes {
+		routes[n] = c
+	}
+	routes[name] = newSettings(conf)
+	s.routes = routes
+	e.conf.Store(&s)
 
 	return nil
 }
 
-func (e *Engine) routeConfig(name string) (c *Config, ok bool) {
-	e.rLock.Lock()
-	defer e.rLock.Unlock()
+// routeConfig returns the config of the route name, or the engine config
+// when the route has none.
+func (e *Engine) routeConfig(name string) *settings {
+	s := e.snapshot()
+	if c, ok := s.routes[name]; ok {
+		return c
+	}
 
-	c, ok = e.routeConfigs[name]
-	return
+	return s.conf
 }
 
 func (e *Engine) Server() *http.Server {
@@ -91,23 +190,33 @@ func (e *Engine) Server() *http.Server {
 	return s
 }
 
-func (engine *Engine) Shutdown(ctx context.Context) error {
-	server := engine.Server()
-	if server == nil {
-		return errors.New("no server")
+// Shutdown fails readiness, runs the shutdown hooks, waits for the health
+// drain delay, gracefully stops the server, waits for tasks started by Go
+// until ctx is done and finally runs the stop hooks.
+func (engine *Engine) Shutdown(ctx context.Context) (err error) {
+	atomic.StoreInt32(&engine.draining, 1)
+	err = engine.hooks.run(ctx, phaseShutdown)
+	engine.drain(ctx)
+	if server := engine.Server(); server == nil {
+		err = firstErr(err, errors.New("no server"))
+	} else {
+		err = firstErr(err, errors.WithStack(server.Shutdown(ctx)))
 	}
-	return errors.WithStack(server.Shutdown(ctx))
+	err = firstErr(err, engine.bg.wait(ctx))
+
+	return firstErr(err, engine.hooks.run(ctx, phaseStop))
 }
 
 func (e *Engine) Run(port string) (err error) {
-	defer func() { log.Println(err) }()
+	defer func() { e.log().Println(err) }()
 	server := &http.Server{
-		Addr:    resolveAddr(port),
-		Handler: e.router,
+		Addr:     resolveAddr(port),
+		Handler:  e,
+		ErrorLog: e.logger,
 	}
 	e.server.Store(server)
 
-	if err = server.ListenAndServe(); err != nil {
+	if err = e.serve(server, server.Serve); err != nil {
 		return errors.Wrapf(err, "port: %v", port)
 	}
 
@@ -115,20 +224,48 @@ func (e *Engine) Run(port string) (err error) {
 }
 
 func (e *Engine) RunTLS(port, certFile, keyFile string) (err error) {
-	defer func() { log.Println(err) }()
+	defer func() { e.log().Println(err) }()
 
 	server := &http.Server{
-		Addr:    resolveAddr(port),
-		Handler: e.router,
+		Addr:     resolveAddr(port),
+		Handler:  e,
+		ErrorLog: e.logger,
 	}
 	e.server.Store(server)
-	if err = server.ListenAndServeTLS(certFile, keyFile); err != nil {
+	serve := func(l net.Listener) error { return server.ServeTLS(l, certFile, keyFile) }
+	if err = e.serve(server, serve); err != nil {
 		err = errors.Wrapf(err, "tls: %s/%s:%s", port, certFile, keyFile)
 	}
 
 	return
 }
 
+// serve runs the start hooks, opens the listener, runs the ready hooks and
+// then serves connections until the server is closed.
+func (e *Engine) serve(server *http.Server, serve func(net.Listener) error) error {
+	if err := e.hooks.run(context.Background(), phaseStart); err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = e.hooks.run(context.Background(), phaseReady); err != nil {
+		l.Close()
+		return err
+	}
+
+	return serve(l)
+}
+
+func firstErr(err, next error) error {
+	if err != nil {
+		return err
+	}
+
+	return next
+}
+
 func resolveAddr(port string) string {
 	return fmt.Sprintf(":%s", strings.Trim(port, ":"))
 }
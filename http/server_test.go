@@ -0,0 +1,337 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineGo(t *testing.T) {
+	e := DefaultEngine()
+	assert.Nil(t, e.SetGoLimit(1))
+
+	var finished int32
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, e.Go(func(ctx context.Context) {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&finished, 1)
+		}))
+	}
+	assert.Nil(t, e.Go(func(ctx context.Context) { panic("boom") }))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, e.bg.wait(ctx))
+	assert.Equal(t, atomic.LoadInt32(&finished), int32(3))
+	assert.Equal(t, e.Go(func(context.Context) {}), ErrEngineClosed)
+}
+
+func TestEngineGoDeadline(t *testing.T) {
+	e := DefaultEngine()
+	cancelled := make(chan struct{})
+	e.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(e.bg.wait(ctx), context.DeadlineExceeded))
+	<-cancelled
+}
+
+type testPlugin struct {
+	calls *[]string
+}
+
+func (testPlugin) Name() string { return "test" }
+
+func (p testPlugin) Install(e *Engine) error {
+	e.OnStart(func(context.Context) error {
+		*p.calls = append(*p.calls, "plugin start")
+		return nil
+	}, HookOrder(-1))
+
+	return nil
+}
+
+func TestEngineLifecycle(t *testing.T) {
+	e := DefaultEngine()
+	var calls []string
+	record := func(name string) Hook {
+		return func(context.Context) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	ready := make(chan struct{})
+	e.OnStart(record("start"))
+	e.OnReady(func(context.Context) error {
+		close(ready)
+		return nil
+	})
+	e.OnShutdown(record("shutdown"))
+	e.OnShutdown(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, HookName("slow"), HookTimeout(time.Millisecond))
+	// no timeout for d <= 0
+	for _, d := range []time.Duration{0, -time.Second} {
+		name := "unbounded " + d.String()
+		e.OnShutdown(func(ctx context.Context) error {
+			time.Sleep(5 * time.Millisecond)
+			if ctx.Err() == nil {
+				calls = append(calls, name)
+			}
+			return nil
+		}, HookTimeout(d))
+	}
+	e.OnStop(record("stop"))
+	assert.Nil(t, e.Register(testPlugin{&calls}))
+	assert.Error(t, e.Register(testPlugin{&calls}))
+
+	go e.Run(":0")
+	<-ready
+	err := e.Shutdown(context.Background())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Contains(t, err.Error(), "shutdown hook slow")
+	assert.Equal(t, calls, []string{"plugin start", "start", "shutdown", "unbounded 0s", "unbounded -1s", "stop"})
+}
+
+func TestEngineHealth(t *testing.T) {
+	e := DefaultEngine()
+	e.Health(&HealthConfig{
+		Liveness: []HealthCheck{{"ping", func(context.Context) error { return nil }}},
+		Readiness: []HealthCheck{
+			{"db", func(context.Context) error { return nil }},
+			{"cache", func(ctx context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			}},
+		},
+		Timeout: 10 * time.Millisecond,
+	})
+
+	w := serve(e, "GET", "/healthz", "", "")
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.JSONEq(t, w.Body.String(), `{"status":"ok","checks":{"ping":"ok"}}`)
+
+	w = serve(e, "GET", "/readyz", "", "")
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+	assert.Equal(t, w.Result().Header.Get("Content-Type"), "application/json; charset=utf-8")
+	assert.JSONEq(t, w.Body.String(), `{"status":"unavailable","checks":{"db":"ok","cache":"timeout"}}`)
+
+	e.Shutdown(context.Background())
+	w = serve(e, "GET", "/readyz", "", "")
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+	assert.JSONEq(t, w.Body.String(), `{"status":"draining"}`)
+}
+
+func TestEngineMaintenance(t *testing.T) {
+	e := DefaultEngine()
+	e.GET("index", "/", func(ctx *Context) { ctx.String(http.StatusOK, "index") })
+	e.GET("admin", "/admin", func(ctx *Context) { ctx.String(http.StatusOK, "admin") })
+	e.Health(&HealthConfig{})
+
+	assert.Error(t, e.SetMaintenance(&Maintenance{Allow: []string{"bad ip"}}))
+	assert.Nil(t, e.SetRouteMaintenance(&Maintenance{RetryAfter: 90 * time.Second}, "admin"))
+	assert.Equal(t, serve(e, "GET", "/", "", "").Code, http.StatusOK)
+	w := serve(e, "GET", "/admin", "", "")
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+	assert.Equal(t, w.Result().Header.Get("Retry-After"), "90")
+	assert.Equal(t, w.Result().Header.Get("Content-Type"), "text/html; charset=utf-8")
+	assert.Contains(t, w.Body.String(), "maintenance")
+
+	assert.Nil(t, e.SetMaintenance(&Maintenance{Allow: []string{"10.0.0.0/8"}}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+	assert.Equal(t, w.Result().Header.Get("Content-Type"), "application/json; charset=utf-8")
+	assert.JSONEq(t, w.Body.String(), `{"error":"service is under maintenance"}`)
+
+	r.RemoteAddr = "10.1.2.3:5678"
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, serve(e, "GET", "/healthz", "", "").Code, http.StatusOK)
+
+	assert.Nil(t, e.SetMaintenance(nil))
+	assert.Nil(t, e.SetRouteMaintenance(nil, "admin"))
+	assert.Equal(t, serve(e, "GET", "/admin", "", "").Code, http.StatusOK)
+}
+
+func TestEngineConcurrencyLimit(t *testing.T) {
+	e := DefaultEngine()
+	block := make(chan struct{})
+	e.GET("slow", "/slow", func(ctx *Context) {
+		<-block
+		ctx.String(http.StatusOK, "ok")
+	})
+	assert.Error(t, e.SetRouteConfig("slow", &Config{MaxInFlight: -1}))
+	assert.Nil(t, e.SetRouteConfig("slow", &Config{
+		TimeOut:      time.Second,
+		MaxInFlight:  1,
+		MaxQueue:     1,
+		QueueTimeout: 20 * time.Millisecond,
+	}))
+
+	waitFor := func(cond func(LimitStats) bool) {
+		for !cond(e.LimitStats()["slow"]) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	first := make(chan int)
+	go func() { first <- serve(e, "GET", "/slow", "", "").Code }()
+	waitFor(func(s LimitStats) bool { return s.InFlight == 1 })
+
+	queued := make(chan int)
+	go func() { queued <- serve(e, "GET", "/slow", "", "").Code }()
+	waitFor(func(s LimitStats) bool { return s.Queued == 1 })
+
+	assert.Equal(t, serve(e, "GET", "/slow", "", "").Code, http.StatusTooManyRequests)
+	assert.Equal(t, <-queued, http.StatusServiceUnavailable)
+	close(block)
+	assert.Equal(t, <-first, http.StatusOK)
+	assert.Equal(t, e.LimitStats()["slow"], LimitStats{MaxInFlight: 1, MaxQueue: 1})
+}
+
+func TestEngineRuntimeRoutes(t *testing.T) {
+	e := DefaultEngine()
+	e.GET("v", "/v", func(ctx *Context) { ctx.String(http.StatusOK, "1") })
+	assert.Error(t, e.Replace("missing", func(*Context) {}))
+	assert.Error(t, e.Remove("missing"))
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					serve(e, "GET", "/v", "", "")
+					serve(e, "GET", "/flag", "", "")
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		e.GET("flag", "/flag", func(ctx *Context) { ctx.String(http.StatusOK, "on") })
+		assert.Nil(t, e.Replace("v", func(ctx *Context) { ctx.String(http.StatusOK, "2") }))
+		assert.Nil(t, e.Remove("flag"))
+	}
+	close(stop)
+	wg.Wait()
+
+	assert.Equal(t, serve(e, "GET", "/v", "", "").Body.String(), "2")
+	assert.Equal(t, serve(e, "GET", "/flag", "", "").Code, http.StatusNotFound)
+	e.GET("flag", "/flag", func(ctx *Context) { ctx.String(http.StatusOK, "on") })
+	assert.Equal(t, serve(e, "GET", "/flag", "", "").Body.String(), "on")
+	e.GET("flag", "/feature", func(ctx *Context) { ctx.String(http.StatusOK, "moved") })
+	assert.Equal(t, serve(e, "GET", "/flag", "", "").Code, http.StatusNotFound)
+	assert.Equal(t, serve(e, "GET", "/feature", "", "").Body.String(), "moved")
+
+	// a conflicting route fails when registered and leaves the others served
+	assert.Panics(t, func() {
+		e.GET("dup", "/feature", func(ctx *Context) {})
+	})
+	assert.Equal(t, serve(e, "GET", "/feature", "", "").Body.String(), "moved")
+	assert.Equal(t, serve(e, "GET", "/v", "", "").Body.String(), "2")
+	assert.Error(t, e.Remove("dup"))
+}
+
+func TestEngineAddRoute(t *testing.T) {
+	e := DefaultEngine()
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		assert.Nil(t, e.AddRoute(name, "GET", "/"+name, func(ctx *Context) { ctx.String(http.StatusOK, name) }))
+	}
+	// a conflicting route is rejected before and after the engine serves
+	assert.Error(t, e.AddRoute("dup", "GET", "/a", func(*Context) {}))
+	assert.Nil(t, e.AddRoute("d", "GET", "/d", func(ctx *Context) { ctx.String(http.StatusOK, "d") }))
+	for _, name := range []string{"a", "b", "c", "d"} {
+		assert.Equal(t, serve(e, "GET", "/"+name, "", "").Body.String(), name)
+	}
+
+	assert.Error(t, e.AddRoute("dup", "GET", "/b", func(*Context) {}))
+	assert.Nil(t, e.AddRoute("e", "GET", "/e", func(ctx *Context) { ctx.String(http.StatusOK, "e") }))
+	assert.Equal(t, serve(e, "GET", "/b", "", "").Body.String(), "b")
+	assert.Equal(t, serve(e, "GET", "/e", "", "").Body.String(), "e")
+}
+
+func TestEngineUse(t *testing.T) {
+	e := DefaultEngine()
+	e.GET("before", "/before", func(ctx *Context) { ctx.String(http.StatusOK, "%v", ctx.Value("mw")) })
+	e.Use(func(ctx *Context, next func(*Context)) {
+		ctx.Set("mw", "global")
+		next(ctx)
+	})
+	e.GET("after", "/after", func(ctx *Context) { ctx.String(http.StatusOK, "%v", ctx.Value("mw")) })
+	assert.Equal(t, serve(e, "GET", "/before", "", "").Body.String(), "global")
+	assert.Nil(t, e.Replace("before", func(ctx *Context) { ctx.String(http.StatusOK, "replaced %v", ctx.Value("mw")) }))
+
+	assert.Equal(t, serve(e, "GET", "/before", "", "").Body.String(), "replaced global")
+	assert.Equal(t, serve(e, "GET", "/after", "", "").Body.String(), "global")
+}
+
+func TestEngineOptions(t *testing.T) {
+	_, err := New(WithTrustedProxies("not-an-ip"))
+	assert.NotNil(t, err)
+
+	var handled error
+	e, err := New(
+		WithCaseInsensitive(true),
+		WithTrustedProxies("10.0.0.0/8"),
+		WithErrorHandler(func(ctx *Context, err error) {
+			handled = err
+			ctx.String(http.StatusTeapot, "oops")
+		}),
+	)
+	assert.Nil(t, err)
+
+	var ip, routeName, copyName string
+	e.GET("who", "/Users/:Name", func(ctx *Context) {
+		ip = ctx.ClientIP().String()
+		routeName = ctx.RouteParams.ByName("Name")
+		cp, cancel := ctx.Copy()
+		copyName = cp.Param("Name")
+		cancel()
+		ctx.String(http.StatusOK, "%s %s", ctx.Request.URL.Path, ctx.Param("Name"))
+	})
+	e.GET("fail", "/fail", func(ctx *Context) {
+		ctx.Fail(errors.New("boom"))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/USERS/Bob", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.2")
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, w.Body.String(), "/USERS/Bob Bob")
+	assert.Equal(t, ip, "203.0.113.7")
+	assert.Equal(t, routeName, "Bob")
+	assert.Equal(t, copyName, "Bob")
+
+	r = httptest.NewRequest(http.MethodGet, "/users/bob", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	e.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, ip, "192.0.2.1")
+
+	w = serve(e, http.MethodGet, "/fail", "", "")
+	assert.Equal(t, w.Code, http.StatusTeapot)
+	assert.Equal(t, handled.Error(), "boom")
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ParamError describes a request value that is missing or cannot be
+// converted to the requested type. It maps to a 400 Bad Request.
+type ParamError struct {
+	Source string
+	Name   string
+	Value  string
+	Err    error
+}
+
+func (e *ParamError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("invalid %s: %v", e.Source, e.Err)
+	}
+
+	return fmt.Sprintf("invalid %s parameter %q: %v", e.Source, e.Name, e.Err)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ParamError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+var errMissingValue = errors.New("value is missing")
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// convert converts vs to T. A slice T receives every value, any other T
+// receives the first one.
+func convert[T any](source, name string, vs []string) (v T, err error) {
+	if len(vs) == 0 {
+		return v, &ParamError{Source: source, Name: name, Err: errMissingValue}
+	}
+	if err = setValues(reflect.ValueOf(&v).Elem(), vs); err != nil {
+		return v, &ParamError{Source: source, Name: name, Value: vs[0], Err: err}
+	}
+
+	return
+}
+
+func setValues(rv reflect.Value, vs []string) error {
+	if rv.Kind() == reflect.Slice && !isScalar(rv) {
+		sli := reflect.MakeSlice(rv.Type(), len(vs), len(vs))
+		for i, s := range vs {
+			if err := setValue(sli.Index(i), s); err != nil {
+				return err
+			}
+		}
+		rv.Set(sli)
+		return nil
+	}
+
+	return setValue(rv, vs[0])
+}
+
+// isScalar reports whether a slice typed value is decoded from a single
+// string, e.g. a TextUnmarshaler such as net.IP.
+func isScalar(rv reflect.Value) bool {
+	_, ok := rv.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+func setValue(rv reflect.Value, s string) error {
+	switch rv.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		rv.SetInt(int64(d))
+		return nil
+	case timeType:
+		t, err := parseTime(s)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if u, ok := rv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		rv.SetBool(b)
+	default:
+		return errors.Errorf("unsupported type %s", rv.Type())
+	}
+
+	return nil
+}
+
+// parseTime accepts RFC 3339 timestamps, dates and unix seconds.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+
+	return time.Time{}, errors.Errorf("cannot parse %q as time", s)
+}
+
+// parseUUID checks s is a textual UUID (8-4-4-4-12 hex digits) and returns
+// it in lower case.
+func parseUUID(s string) (string, error) {
+	if len(s) != 36 {
+		return "", errors.Errorf("invalid UUID length %d", len(s))
+	}
+	b := []byte(s)
+	for i, c := range b {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return "", errors.Errorf("invalid UUID format")
+			}
+			continue
+		}
+		switch {
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f':
+		case 'A' <= c && c <= 'F':
+			b[i] = c + ('a' - 'A')
+		default:
+			return "", errors.Errorf("invalid UUID format")
+		}
+	}
+
+	return string(b), nil
+}